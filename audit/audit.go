@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
+	"github.com/ONSdigital/go-ns/avro"
 	"github.com/ONSdigital/go-ns/common"
 	"github.com/ONSdigital/log.go/v2/log"
 )
@@ -28,7 +30,7 @@ type Error struct {
 	Params common.Params
 }
 
-//Event holds data about the action being attempted
+//Event holds data about the action being attempted. The fields after Signature are only encoded by EventV2Schema.
 type Event struct {
 	Created         string        `avro:"created" json:"created,omitempty"`
 	Service         string        `avro:"service" json:"service,omitempty"`
@@ -37,6 +39,17 @@ type Event struct {
 	AttemptedAction string        `avro:"attempted_action" json:"attempted_action,omitempty"`
 	ActionResult    string        `avro:"action_result" json:"action_result,omitempty"`
 	Params          common.Params `avro:"params" json:"params,omitempty"`
+	ChainID         string        `avro:"chain_id" json:"chain_id,omitempty"`
+	Sequence        int64         `avro:"sequence" json:"sequence,omitempty"`
+	PreviousDigest  string        `avro:"previous_digest" json:"previous_digest,omitempty"`
+	Signature       string        `avro:"signature" json:"signature,omitempty"`
+	Timestamp       time.Time     `avro:"timestamp" json:"timestamp"`
+	Caller          string        `avro:"caller" json:"caller,omitempty"`
+	Method          string        `avro:"method" json:"method,omitempty"`
+	Path            string        `avro:"path" json:"path,omitempty"`
+	StatusCode      int           `avro:"status_code" json:"status_code,omitempty"`
+	ClientIP        string        `avro:"client_ip" json:"client_ip,omitempty"`
+	LatencyMillis   int64         `avro:"latency_millis" json:"latency_millis,omitempty"`
 }
 
 type avroMarshaller func(s interface{}) ([]byte, error)
@@ -55,8 +68,27 @@ type AuditorService interface {
 // recording audit events
 type Auditor struct {
 	service       string
+	schema        *avro.Schema
 	marshalToAvro avroMarshaller
 	producer      OutboundProducer
+	sink          Sink
+	signer        *Signer
+	policy        Policy
+	redaction     *RedactionPolicy
+	templates     *ParameterTemplates
+	delivery      DeliveryConfig
+	batch         *batch
+
+	queue       chan []byte
+	mu          sync.RWMutex
+	closed      bool
+	spooling    sync.Mutex
+	closeOnce   sync.Once
+	closing     chan struct{}
+	abandonOnce sync.Once
+	abandoned   chan struct{}
+	workers     sync.WaitGroup
+	done        chan struct{}
 }
 
 // NopAuditor is an no op implementation of the AuditorService.
@@ -73,16 +105,33 @@ func New(producer OutboundProducer, namespace string) *Auditor {
 	return &Auditor{
 		producer:      producer,
 		service:       namespace,
+		schema:        EventSchema,
 		marshalToAvro: EventSchema.Marshal,
 	}
 }
 
+// UseSchema sets the schema the auditor encodes events with, which is EventSchema unless set to EventV2Schema.
+// Batches of events are encoded with the matching batch schema. An auditor that signs its events must use
+// EventV2Schema.
+func (a *Auditor) UseSchema(schema *avro.Schema) {
+	a.schema = schema
+	a.marshalToAvro = schema.Marshal
+}
+
 //Record captures the provided action, result and parameters and an audit event. Common fields - time, user, service
 // are added automatically. An error is returned if there is a problem recording the event it is up to the caller to
 // decide what do with the error in these cases.
 // NOTE: Record relies on the identity middleware having run first. If no user / service identity is available in the
-// provided context an error will be returned.
-func (a *Auditor) Record(ctx context.Context, attemptedAction string, actionResult string, params common.Params) (err error) {
+// provided context an error will be returned. Only actions taken by users are recorded unless the auditor has a
+// Policy that says otherwise.
+// Record waits until the event has been handed to the producer, or to the buffer of an Auditor created with
+// NewWithDelivery, and returns an error if the context is done or the delivery timeout passes first. Auditors
+// created with NewWithSink wait until the sink has written the event.
+func (a *Auditor) Record(ctx context.Context, attemptedAction string, actionResult string, params common.Params) error {
+	return a.record(ctx, attemptedAction, actionResult, params, false)
+}
+
+func (a *Auditor) record(ctx context.Context, attemptedAction string, actionResult string, params common.Params, confirm bool) (err error) {
 	var e Event
 	defer func() {
 		if err != nil {
@@ -96,6 +145,8 @@ func (a *Auditor) Record(ctx context.Context, attemptedAction string, actionResu
 		}
 	}()
 
+	params = a.redaction.Apply(params)
+
 	//NOTE: for now we are only auditing user actions - this may be subject to change
 	user := common.User(ctx)
 	service := common.Caller(ctx)
@@ -105,8 +156,13 @@ func (a *Auditor) Record(ctx context.Context, attemptedAction string, actionResu
 		return
 	}
 
-	if user == "" {
-		log.Info(ctx, "not user attempted action: skipping audit event")
+	actors := a.policy.actors(attemptedAction)
+	if !actors.audits(user != "") {
+		if user == "" {
+			log.Info(ctx, "not user attempted action: skipping audit event", log.Data{"auditAction": attemptedAction, "auditActors": actors.String()})
+		} else {
+			log.Info(ctx, "not service attempted action: skipping audit event", log.Data{"auditAction": attemptedAction, "auditActors": actors.String()})
+		}
 		return
 	}
 
@@ -119,27 +175,66 @@ func (a *Auditor) Record(ctx context.Context, attemptedAction string, actionResu
 		return
 	}
 
+	eventParams := params
+	if user == "" {
+		eventParams = withCaller(params, service)
+	}
+
+	now := time.Now()
 	e = Event{
 		Service:         a.service,
 		User:            user,
 		AttemptedAction: attemptedAction,
 		ActionResult:    actionResult,
-		Created:         time.Now().String(),
-		Params:          params,
+		Created:         now.String(),
+		Params:          eventParams,
+		Timestamp:       now,
+		Caller:          service,
 	}
+	addRequestInfo(ctx, &e, now)
 
 	e.RequestID = common.GetRequestId(ctx)
 
-	avroBytes, err := a.marshalToAvro(e)
-	if err != nil {
-		err = NewAuditError("error marshalling event to avro", attemptedAction, actionResult, params)
-		return
+	deliver := func() error {
+		if a.sink != nil {
+			if sinkErr := a.sink.Write(ctx, e); sinkErr != nil {
+				return NewAuditError("error writing event to sink: "+sinkErr.Error(), attemptedAction, actionResult, params)
+			}
+			return nil
+		}
+
+		avroBytes, err := a.marshalToAvro(e)
+		if err != nil {
+			return NewAuditError("error marshalling event to avro", attemptedAction, actionResult, params)
+		}
+
+		if deliveryErr := a.deliver(ctx, avroBytes, confirm); deliveryErr != nil {
+			return NewAuditError(deliveryErr.Error(), attemptedAction, actionResult, params)
+		}
+		return nil
 	}
 
-	a.producer.Output() <- avroBytes
+	if a.signer != nil {
+		if err = a.signable(); err != nil {
+			err = NewAuditError("error signing event: "+err.Error(), attemptedAction, actionResult, params)
+			return
+		}
+		err = a.signer.chain(&e, deliver)
+		return
+	}
+	err = deliver()
 	return
 }
 
+// withCaller returns a copy of params with the caller identity of the service that took the action added
+func withCaller(params common.Params, caller string) common.Params {
+	p := common.Params{"caller_identity": caller}
+	for k, v := range params {
+		p[k] = v
+	}
+	return p
+}
+
 //NewAuditError creates new audit.Error with default field values where necessary and orders the params alphabetically.
 func NewAuditError(cause string, attemptedAction string, actionResult string, params common.Params) Error {
 	return Error{
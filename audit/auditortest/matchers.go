@@ -0,0 +1,329 @@
+package auditortest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/go-ns/common"
+)
+
+// Call is a call made to Record
+type Call struct {
+	Ctx    context.Context
+	Action string
+	Result string
+	Params common.Params
+}
+
+func (c Call) String() string {
+	keys := make([]string, 0, len(c.Params))
+	for k := range c.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, fmt.Sprintf("%s:%q", k, c.Params[k]))
+	}
+	return fmt.Sprintf("%s %s [%s]", c.Action, c.Result, strings.Join(params, ", "))
+}
+
+// Matcher matches calls to Record on one of their values
+type Matcher struct {
+	description string
+	match       func(c Call) bool
+	// caller is set for matchers on the caller identity, which events only carry in the v2 schema
+	caller bool
+}
+
+func (m Matcher) String() string {
+	return m.description
+}
+
+// Action matches calls for action
+func Action(action string) Matcher {
+	return Matcher{description: fmt.Sprintf("action %q", action), match: func(c Call) bool { return c.Action == action }}
+}
+
+// Result matches calls with result
+func Result(result string) Matcher {
+	return Matcher{description: fmt.Sprintf("result %q", result), match: func(c Call) bool { return c.Result == result }}
+}
+
+// Params matches calls with exactly params
+func Params(params common.Params) Matcher {
+	return Matcher{description: fmt.Sprintf("params %v", params), match: func(c Call) bool {
+		if len(c.Params) != len(params) {
+			return false
+		}
+		return includes(c.Params, params)
+	}}
+}
+
+// ParamsInclude matches calls with params that include every key and value of params, and may have others
+func ParamsInclude(params common.Params) Matcher {
+	return Matcher{description: fmt.Sprintf("params including %v", params), match: func(c Call) bool {
+		return includes(c.Params, params)
+	}}
+}
+
+// ParamMatches matches calls with a param key whose value matches the regular expression pattern, which must compile
+func ParamMatches(key, pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return Matcher{description: fmt.Sprintf("param %s matching %q", key, pattern), match: func(c Call) bool {
+		v, ok := c.Params[key]
+		return ok && re.MatchString(v)
+	}}
+}
+
+// User matches calls whose context has the user identity user
+func User(user string) Matcher {
+	return Matcher{description: fmt.Sprintf("user %q", user), match: func(c Call) bool {
+		return c.Ctx != nil && common.User(c.Ctx) == user
+	}}
+}
+
+// Caller matches calls whose context has the caller identity caller. Events are only checked for their caller by a
+// Recorder with its Schema set to audit.EventV2Schema, as v1 events do not carry it.
+func Caller(caller string) Matcher {
+	return Matcher{description: fmt.Sprintf("caller %q", caller), caller: true, match: func(c Call) bool {
+		return c.Ctx != nil && common.Caller(c.Ctx) == caller
+	}}
+}
+
+// RequestID matches calls whose context has the request ID id
+func RequestID(id string) Matcher {
+	return Matcher{description: fmt.Sprintf("request ID %q", id), match: func(c Call) bool {
+		return c.Ctx != nil && common.GetRequestId(c.Ctx) == id
+	}}
+}
+
+func includes(params, subset common.Params) bool {
+	for k, v := range subset {
+		if actual, ok := params[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Expectation is the number of calls to Record expected to match all of its matchers
+type Expectation struct {
+	matchers []Matcher
+	min, max int
+}
+
+// Recorded expects at least one call matching all of matchers
+func Recorded(matchers ...Matcher) Expectation {
+	return Expectation{matchers: matchers, min: 1, max: -1}
+}
+
+// NeverRecorded expects no calls matching all of matchers
+func NeverRecorded(matchers ...Matcher) Expectation {
+	return Expectation{matchers: matchers, min: 0, max: 0}
+}
+
+// Times expects exactly n matching calls
+func (e Expectation) Times(n int) Expectation {
+	e.min, e.max = n, n
+	return e
+}
+
+// Between expects from min to max matching calls
+func (e Expectation) Between(min, max int) Expectation {
+	e.min, e.max = min, max
+	return e
+}
+
+func (e Expectation) matches(c Call) bool {
+	for _, m := range e.matchers {
+		if !m.match(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCaller reports whether the expectation has a matcher on the caller identity
+func (e Expectation) matchesCaller() bool {
+	for _, m := range e.matchers {
+		if m.caller {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Expectation) String() string {
+	matchers := make([]string, 0, len(e.matchers))
+	for _, m := range e.matchers {
+		matchers = append(matchers, m.String())
+	}
+	if len(matchers) == 0 {
+		matchers = append(matchers, "anything")
+	}
+
+	var times string
+	switch {
+	case e.max < 0:
+		times = fmt.Sprintf("at least %d", e.min)
+	case e.min == e.max:
+		times = fmt.Sprint(e.min)
+	default:
+		times = fmt.Sprintf("%d to %d", e.min, e.max)
+	}
+	return fmt.Sprintf("%s calls with %s", times, strings.Join(matchers, ", "))
+}
+
+// verify checks that calls meet every expectation, in any order
+func verify(calls []Call, expectations []Expectation) error {
+	var failures []string
+	for _, e := range expectations {
+		n := 0
+		for _, c := range calls {
+			if e.matches(c) {
+				n++
+			}
+		}
+		if n < e.min || (e.max >= 0 && n > e.max) {
+			failures = append(failures, fmt.Sprintf("expected %v, but found %d", e, n))
+		}
+	}
+	return failure(calls, failures)
+}
+
+// verifyInOrder checks that calls meet the expectations one after another. Each expectation is met by the calls that
+// match it after those that met the expectation before it, up to the first call that does not match. An expectation
+// of no calls is met if none of the calls after those that met the expectation before it match.
+func verifyInOrder(calls []Call, expectations []Expectation) error {
+	i := 0
+	for _, e := range expectations {
+		if e.max == 0 {
+			n := 0
+			for _, c := range calls[i:] {
+				if e.matches(c) {
+					n++
+				}
+			}
+			if n > 0 {
+				return failure(calls, []string{fmt.Sprintf("expected %v in order, but found %d", e, n)})
+			}
+			continue
+		}
+
+		// skip to the first call the expectation matches
+		for i < len(calls) && e.min > 0 && !e.matches(calls[i]) {
+			i++
+		}
+		n := 0
+		for i < len(calls) && e.matches(calls[i]) {
+			n++
+			i++
+		}
+		if n < e.min || (e.max >= 0 && n > e.max) {
+			return failure(calls, []string{fmt.Sprintf("expected %v in order, but found %d", e, n)})
+		}
+	}
+	return nil
+}
+
+func failure(calls []Call, failures []string) error {
+	if len(failures) == 0 {
+		return nil
+	}
+
+	msg := "auditor.Record " + strings.Join(failures, "; ")
+	if len(calls) == 0 {
+		return fmt.Errorf("%s; Record was not called", msg)
+	}
+	msg += "; calls were:"
+	for i, c := range calls {
+		msg += fmt.Sprintf("\n\t%d. %v", i+1, c)
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// TestingT is the part of testing.T used to report failed assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Calls returns the calls made to Record
+func (m *MockAuditor) Calls() []Call {
+	calls := make([]Call, 0, len(m.RecordCalls()))
+	for _, c := range m.RecordCalls() {
+		calls = append(calls, Call{Ctx: c.Ctx, Action: c.Action, Result: c.Result, Params: c.Params})
+	}
+	return calls
+}
+
+// Verify returns an error describing the expectations not met by the calls made to Record, in any order
+func (m *MockAuditor) Verify(expectations ...Expectation) error {
+	return verify(m.Calls(), expectations)
+}
+
+// VerifyInOrder returns an error if the calls made to Record do not meet expectations one after another
+func (m *MockAuditor) VerifyInOrder(expectations ...Expectation) error {
+	return verifyInOrder(m.Calls(), expectations)
+}
+
+// AssertRecorded fails t unless the calls made to Record meet every expectation, in any order
+func (m *MockAuditor) AssertRecorded(t TestingT, expectations ...Expectation) {
+	t.Helper()
+	if err := m.Verify(expectations...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// AssertRecordedInOrder fails t unless the calls made to Record meet expectations one after another
+func (m *MockAuditor) AssertRecordedInOrder(t TestingT, expectations ...Expectation) {
+	t.Helper()
+	if err := m.VerifyInOrder(expectations...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// verifier is a MockAuditor or Recorder
+type verifier interface {
+	Verify(expectations ...Expectation) error
+	VerifyInOrder(expectations ...Expectation) error
+}
+
+// ShouldHaveRecorded is a GoConvey assertion that a MockAuditor or Recorder meets the expectations, in any order:
+//
+//	So(auditor, auditortest.ShouldHaveRecorded, auditortest.Recorded(auditortest.Action("my_action")))
+func ShouldHaveRecorded(actual interface{}, expected ...interface{}) string {
+	return assertion(actual, expected, verifier.Verify)
+}
+
+// ShouldHaveRecordedInOrder is a GoConvey assertion that a MockAuditor or Recorder meets the expectations one after
+// another
+func ShouldHaveRecordedInOrder(actual interface{}, expected ...interface{}) string {
+	return assertion(actual, expected, verifier.VerifyInOrder)
+}
+
+func assertion(actual interface{}, expected []interface{}, check func(verifier, ...Expectation) error) string {
+	v, ok := actual.(verifier)
+	if !ok {
+		return fmt.Sprintf("expected a *auditortest.MockAuditor or *auditortest.Recorder but was %T", actual)
+	}
+
+	expectations := make([]Expectation, 0, len(expected))
+	for _, e := range expected {
+		expectation, ok := e.(Expectation)
+		if !ok {
+			return fmt.Sprintf("expected auditortest.Expectations but was given %T", e)
+		}
+		expectations = append(expectations, expectation)
+	}
+
+	if err := check(v, expectations...); err != nil {
+		return err.Error()
+	}
+	return ""
+}
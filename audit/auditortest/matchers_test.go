@@ -0,0 +1,93 @@
+package auditortest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeT records the failures reported to it
+type fakeT struct {
+	failures []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func TestMatchers(t *testing.T) {
+	Convey("given an auditor that has recorded an attempted and successful action", t, func() {
+		auditor := New()
+		ctx := common.WithRequestId(common.SetUser(context.Background(), "alice"), "req-1")
+		params := common.Params{"dataset_id": "cpih01", "edition": "2018"}
+		auditor.Record(ctx, "put_dataset", audit.Attempted, params)
+		auditor.Record(ctx, "put_dataset", audit.Successful, params)
+
+		Convey("then calls can be matched on part of their params and in any order", func() {
+			So(auditor, ShouldHaveRecorded,
+				Recorded(Action("put_dataset"), Result(audit.Successful), ParamsInclude(common.Params{"edition": "2018"})),
+				Recorded(Action("put_dataset"), Result(audit.Attempted)),
+			)
+		})
+
+		Convey("then param values can be matched with regular expressions", func() {
+			So(auditor, ShouldHaveRecorded, Recorded(ParamMatches("dataset_id", "^cpih")).Times(2))
+		})
+
+		Convey("then the identity in the context of the calls can be matched", func() {
+			So(auditor, ShouldHaveRecorded, Recorded(User("alice"), RequestID("req-1")).Times(2))
+			So(auditor, ShouldHaveRecorded, NeverRecorded(Caller("dp-import-tracker")))
+		})
+
+		Convey("then calls can be matched in order", func() {
+			So(auditor, ShouldHaveRecordedInOrder, Recorded(Result(audit.Attempted)), Recorded(Result(audit.Successful)))
+			So(auditor, ShouldNotHaveRecordedInOrder, Recorded(Result(audit.Successful)), Recorded(Result(audit.Attempted)))
+		})
+
+		Convey("then calls matched in order are not allowed to go over the number expected", func() {
+			So(auditor, ShouldHaveRecordedInOrder, Recorded(Action("put_dataset")).Times(2))
+			So(auditor, ShouldNotHaveRecordedInOrder, Recorded(Action("put_dataset")).Times(1))
+			So(auditor, ShouldNotHaveRecordedInOrder, Recorded(Action("put_dataset")).Between(0, 1))
+		})
+
+		Convey("then an action never recorded in order is not found among the calls after the expectations before it", func() {
+			So(auditor, ShouldHaveRecordedInOrder, Recorded(Result(audit.Attempted)), NeverRecorded(Result(audit.Attempted)))
+			So(auditor, ShouldHaveRecordedInOrder, NeverRecorded(Action("delete_dataset")), Recorded(Result(audit.Attempted)))
+			So(auditor, ShouldNotHaveRecordedInOrder, NeverRecorded(Action("put_dataset")))
+			So(auditor, ShouldNotHaveRecordedInOrder, Recorded(Result(audit.Attempted)), NeverRecorded(Result(audit.Successful)))
+		})
+
+		Convey("then failures describe the expectation and the calls", func() {
+			err := auditor.Verify(Recorded(Action("put_dataset"), Params(common.Params{"dataset_id": "cpih01"})).Between(1, 2),
+				NeverRecorded(Result(audit.Successful)))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `auditor.Record expected 1 to 2 calls with action "put_dataset", params map[dataset_id:cpih01], but found 0; `+
+				`expected 0 calls with result "successful", but found 1; calls were:
+	1. put_dataset attempted [dataset_id:"cpih01", edition:"2018"]
+	2. put_dataset successful [dataset_id:"cpih01", edition:"2018"]`)
+		})
+
+		Convey("then failures are reported to a plain testing.T", func() {
+			ft := &fakeT{}
+			auditor.AssertRecorded(ft, Recorded(Action("put_dataset")).Times(2))
+			So(ft.failures, ShouldBeEmpty)
+
+			auditor.AssertRecorded(ft, Recorded(Action("delete_dataset")))
+			So(ft.failures, ShouldHaveLength, 1)
+		})
+	})
+}
+
+// ShouldNotHaveRecordedInOrder is the negation of ShouldHaveRecordedInOrder, for testing it
+func ShouldNotHaveRecordedInOrder(actual interface{}, expected ...interface{}) string {
+	if ShouldHaveRecordedInOrder(actual, expected...) == "" {
+		return "expected the calls not to have been recorded in order"
+	}
+	return ""
+}
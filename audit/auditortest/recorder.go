@@ -0,0 +1,205 @@
+package auditortest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/avro"
+	"github.com/ONSdigital/go-ns/common"
+)
+
+// RecorderCapacity is the number of messages a Recorder holds while they wait to be decoded
+const RecorderCapacity = 1024
+
+// Recorder is an audit.OutboundProducer that decodes the messages a real audit.Auditor sends to it, so that tests
+// check the events that would actually have been published, after validation, identity rules and avro marshalling.
+// Messages are decoded as they are sent, so any number of events can be recorded, until the Recorder is closed.
+type Recorder struct {
+	// Schema decodes the messages, and is audit.EventSchema unless set, before any are sent, to match the schema used
+	// by the auditor. Events decoded with audit.EventSchema have no caller, so Caller expectations need
+	// audit.EventV2Schema.
+	Schema *avro.Schema
+
+	output    chan []byte
+	flush     chan chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	events []audit.Event
+	errs   []error
+}
+
+// NewRecorder returns a Recorder decoding messages with audit.EventSchema. It should be closed once the test is done
+// with it.
+func NewRecorder() *Recorder {
+	r := &Recorder{
+		Schema:  audit.EventSchema,
+		output:  make(chan []byte, RecorderCapacity),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// NewRecordingAuditor returns an audit.Auditor for service that sends its events to a new Recorder
+func NewRecordingAuditor(service string) (*audit.Auditor, *Recorder) {
+	r := NewRecorder()
+	return audit.New(r, service), r
+}
+
+// Output returns the channel the auditor sends messages to
+func (r *Recorder) Output() chan []byte {
+	return r.output
+}
+
+// Close stops decoding messages, once those already sent have been decoded. Messages sent after Close are not
+// decoded, so an auditor that buffers or batches events should be closed first. The events sent before Close can
+// still be checked.
+func (r *Recorder) Close() {
+	r.closeOnce.Do(func() { close(r.done) })
+	<-r.stopped
+}
+
+// Events returns the events sent so far, in the order they were sent. Auditors that buffer or batch events must be
+// closed first.
+func (r *Recorder) Events() []audit.Event {
+	r.sync()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]audit.Event(nil), r.events...)
+}
+
+// Errors returns the errors from decoding the messages sent so far
+func (r *Recorder) Errors() []error {
+	r.sync()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errs...)
+}
+
+// Reset discards the events sent so far
+func (r *Recorder) Reset() {
+	r.sync()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events, r.errs = nil, nil
+}
+
+// run decodes messages as they are sent until the Recorder is closed
+func (r *Recorder) run() {
+	defer close(r.stopped)
+	for {
+		select {
+		case message := <-r.output:
+			r.decode(message)
+		case reply := <-r.flush:
+			r.drain()
+			close(reply)
+		case <-r.done:
+			r.drain()
+			return
+		}
+	}
+}
+
+// sync waits until the messages sent so far have been decoded
+func (r *Recorder) sync() {
+	reply := make(chan struct{})
+	select {
+	case r.flush <- reply:
+		<-reply
+	case <-r.stopped:
+	}
+}
+
+// drain decodes the messages waiting in the output channel
+func (r *Recorder) drain() {
+	for {
+		select {
+		case message := <-r.output:
+			r.decode(message)
+		default:
+			return
+		}
+	}
+}
+
+func (r *Recorder) decode(message []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var e audit.Event
+	if err := r.Schema.Unmarshal(message, &e); err != nil {
+		r.errs = append(r.errs, fmt.Errorf("message %d could not be decoded: %w", len(r.events)+len(r.errs)+1, err))
+		return
+	}
+	r.events = append(r.events, e)
+}
+
+// calls returns the events sent as calls, with a context holding the identities and request ID of each event, so
+// that they can be checked against expectations with the same matchers as calls to a MockAuditor
+func (r *Recorder) calls(expectations []Expectation) ([]Call, error) {
+	if r.Schema == audit.EventSchema {
+		for _, e := range expectations {
+			if e.matchesCaller() {
+				return nil, fmt.Errorf("auditortest.Recorder: cannot check %v, as events decoded with audit.EventSchema "+
+					"have no caller; set Schema to audit.EventV2Schema and have the auditor use it", e)
+			}
+		}
+	}
+
+	if errs := r.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("auditortest.Recorder: %v", errs[0])
+	}
+
+	events := r.Events()
+	calls := make([]Call, 0, len(events))
+	for _, e := range events {
+		ctx := common.WithRequestId(context.Background(), e.RequestID)
+		ctx = common.SetUser(ctx, e.User)
+		ctx = common.SetCaller(ctx, e.Caller)
+		calls = append(calls, Call{Ctx: ctx, Action: e.AttemptedAction, Result: e.ActionResult, Params: e.Params})
+	}
+	return calls, nil
+}
+
+// Verify returns an error describing the expectations not met by the events sent, in any order
+func (r *Recorder) Verify(expectations ...Expectation) error {
+	calls, err := r.calls(expectations)
+	if err != nil {
+		return err
+	}
+	return verify(calls, expectations)
+}
+
+// VerifyInOrder returns an error if the events sent do not meet expectations one after another
+func (r *Recorder) VerifyInOrder(expectations ...Expectation) error {
+	calls, err := r.calls(expectations)
+	if err != nil {
+		return err
+	}
+	return verifyInOrder(calls, expectations)
+}
+
+// AssertRecorded fails t unless the events sent meet every expectation, in any order
+func (r *Recorder) AssertRecorded(t TestingT, expectations ...Expectation) {
+	t.Helper()
+	if err := r.Verify(expectations...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// AssertRecordedInOrder fails t unless the events sent meet expectations one after another
+func (r *Recorder) AssertRecordedInOrder(t TestingT, expectations ...Expectation) {
+	t.Helper()
+	if err := r.VerifyInOrder(expectations...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+var _ audit.OutboundProducer = (*Recorder)(nil)
@@ -0,0 +1,82 @@
+package auditortest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecorder(t *testing.T) {
+	Convey("given a real auditor sending events to a recorder", t, func() {
+		auditor, recorder := NewRecordingAuditor("dp-dataset-api")
+		ctx := common.WithRequestId(common.SetUser(context.Background(), "alice"), "req-1")
+		Reset(recorder.Close)
+
+		Convey("then the events that would have been published are decoded", func() {
+			So(auditor.Record(ctx, "put_dataset", audit.Attempted, common.Params{"dataset_id": "cpih01"}), ShouldBeNil)
+			So(auditor.Record(ctx, "put_dataset", audit.Successful, common.Params{"dataset_id": "cpih01"}), ShouldBeNil)
+
+			events := recorder.Events()
+			So(events, ShouldHaveLength, 2)
+			So(events[0].Service, ShouldEqual, "dp-dataset-api")
+			So(events[0].User, ShouldEqual, "alice")
+			So(events[0].RequestID, ShouldEqual, "req-1")
+
+			So(recorder, ShouldHaveRecordedInOrder,
+				Recorded(Action("put_dataset"), Result(audit.Attempted), User("alice"), RequestID("req-1")),
+				Recorded(Action("put_dataset"), Result(audit.Successful), Params(common.Params{"dataset_id": "cpih01"})),
+			)
+		})
+
+		Convey("then events the auditor skips or rejects are not published", func() {
+			serviceCtx := common.SetCaller(context.Background(), "dp-import-tracker")
+			So(auditor.Record(serviceCtx, "put_dataset", audit.Attempted, nil), ShouldBeNil)
+			So(auditor.Record(ctx, "", audit.Attempted, nil), ShouldNotBeNil)
+
+			So(recorder.Events(), ShouldBeEmpty)
+			So(recorder, ShouldHaveRecorded, NeverRecorded())
+		})
+
+		Convey("then more events than the recorder holds can be recorded before they are checked", func() {
+			for i := 0; i < RecorderCapacity*2; i++ {
+				So(auditor.Record(ctx, "put_dataset", audit.Attempted, nil), ShouldBeNil)
+			}
+			So(recorder.Events(), ShouldHaveLength, RecorderCapacity*2)
+		})
+
+		Convey("then the events sent before it is closed can still be checked", func() {
+			So(auditor.Record(ctx, "put_dataset", audit.Attempted, nil), ShouldBeNil)
+			recorder.Close()
+			So(recorder, ShouldHaveRecorded, Recorded(Action("put_dataset")).Times(1))
+		})
+
+		Convey("then the caller can only be checked once the recorder decodes v2 events", func() {
+			serviceCtx := common.SetCaller(ctx, "dp-import-tracker")
+			So(auditor.Record(serviceCtx, "put_dataset", audit.Attempted, nil), ShouldBeNil)
+
+			err := recorder.Verify(Recorded(Caller("dp-import-tracker")))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "set Schema to audit.EventV2Schema")
+
+			auditor, recorder := NewRecordingAuditor("dp-dataset-api")
+			defer recorder.Close()
+			auditor.UseSchema(audit.EventV2Schema)
+			recorder.Schema = audit.EventV2Schema
+			So(auditor.Record(serviceCtx, "put_dataset", audit.Attempted, nil), ShouldBeNil)
+			So(recorder, ShouldHaveRecorded, Recorded(Caller("dp-import-tracker"), User("alice")))
+		})
+
+		Convey("then messages that cannot be decoded fail the assertions", func() {
+			recorder.Output() <- []byte{0xff}
+
+			So(recorder.Errors(), ShouldHaveLength, 1)
+			So(recorder.Verify(), ShouldNotBeNil)
+
+			recorder.Reset()
+			So(recorder.Verify(), ShouldBeNil)
+		})
+	})
+}
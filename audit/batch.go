@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// BatchConfig sets how an Auditor groups events into batches, each of which is sent to the producer as a single
+// message encoded with EventBatchSchema, or EventBatchV2Schema if the auditor uses EventV2Schema. A batch is flushed
+// as soon as any of its limits is reached.
+type BatchConfig struct {
+	// MaxEvents is the number of events in a full batch
+	MaxEvents int
+	// MaxBytes is the encoded size of a full batch
+	MaxBytes int
+	// Linger is the longest an event waits for its batch to fill up. Without it a batch that never fills is only sent
+	// when the auditor is closed.
+	Linger time.Duration
+}
+
+// EventBatch is a batch of audit events, as encoded by EventBatchSchema or EventBatchV2Schema
+type EventBatch struct {
+	Events []Event `avro:"events"`
+}
+
+func (c BatchConfig) enabled() bool {
+	return c.MaxEvents > 0 || c.MaxBytes > 0 || c.Linger > 0
+}
+
+// batch holds the encoded events waiting to be flushed. A batch is taken out of it under the lock and handed over
+// without holding the lock, so that a producer that has stopped reading does not hold up events being added.
+type batch struct {
+	mu      sync.Mutex
+	pending []batched
+	size    int
+	closed  bool
+	// next is the id of the next event added
+	next uint64
+	// generation counts the batches taken out to be flushed, so that a linger timer does not flush a later batch
+	// than its own
+	generation int
+	timer      *time.Timer
+
+	// sending is held while a batch is handed over, so that batches are sent in the order they were taken out
+	sending chan struct{}
+	// ctx is cancelled when the auditor is closed, so that flushes other than the last give up
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// batched is an encoded event waiting in a batch
+type batched struct {
+	id      uint64
+	message []byte
+}
+
+func newBatch() *batch {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &batch{sending: make(chan struct{}, 1), ctx: ctx, cancel: cancel}
+}
+
+// addToBatch adds message to the current batch, flushing it if it is full. If a full batch cannot be flushed the
+// event is taken out of it again and the error returned, leaving the events recorded before it to be retried.
+func (a *Auditor) addToBatch(ctx context.Context, message []byte) error {
+	b := a.batch
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errAuditorClosed
+	}
+
+	id := b.next
+	b.next++
+	b.pending = append(b.pending, batched{id: id, message: message})
+	b.size += len(message)
+	full := a.batchFull()
+	if !full {
+		a.lingerLater()
+	}
+	b.mu.Unlock()
+	if !full {
+		return nil
+	}
+
+	// the auditor flushes what is left itself when it is closed, so this flush gives up
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(b.ctx, cancel)
+	defer stop()
+
+	err := a.flushBatch(ctx, func() bool { return b.holds(id) })
+	if err == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	b.remove(id)
+	b.mu.Unlock()
+	if b.ctx.Err() != nil && err == errDeliveryCancelled {
+		return errAuditorClosed
+	}
+	return err
+}
+
+// batchFull reports whether the current batch has reached any of its limits. The caller must hold the batch lock.
+func (a *Auditor) batchFull() bool {
+	config := a.delivery.Batch
+	return (config.MaxEvents > 0 && len(a.batch.pending) >= config.MaxEvents) ||
+		(config.MaxBytes > 0 && a.batch.size >= config.MaxBytes)
+}
+
+// lingerLater starts the linger timer of the current batch, if it has events and no timer running. The caller must
+// hold the batch lock.
+func (a *Auditor) lingerLater() {
+	b := a.batch
+	if a.delivery.Batch.Linger <= 0 || b.closed || b.timer != nil || len(b.pending) == 0 {
+		return
+	}
+	generation := b.generation
+	b.timer = time.AfterFunc(a.delivery.Batch.Linger, func() { a.flushLingering(generation) })
+}
+
+// flushLingering flushes the batch of the given generation once it has waited for as long as it is allowed to
+func (a *Auditor) flushLingering(generation int) {
+	b := a.batch
+	b.mu.Lock()
+	if b.generation != generation {
+		b.mu.Unlock()
+		return
+	}
+	b.timer = nil
+	b.mu.Unlock()
+
+	ctx := b.ctx
+	if a.delivery.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.delivery.Timeout)
+		defer cancel()
+	}
+
+	err := a.flushBatch(ctx, func() bool { return b.generation == generation && len(b.pending) > 0 })
+	if err != nil && b.ctx.Err() == nil {
+		log.Error(ctx, "failed to flush batch of audit events, will retry", err)
+		b.mu.Lock()
+		a.lingerLater()
+		b.mu.Unlock()
+	}
+}
+
+// closeBatch stops the auditor adding events to batches, stops any other flush and flushes the current batch
+func (a *Auditor) closeBatch(ctx context.Context) error {
+	b := a.batch
+	b.mu.Lock()
+	b.closed = true
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+	b.cancel()
+
+	return a.flushBatch(ctx, func() bool { return len(b.pending) > 0 })
+}
+
+// flushBatch hands the current batch to the producer, or to the buffer or spool if the auditor has them, once any
+// batch being flushed already has been handed over. Nothing is flushed, and nil returned, unless flush reports,
+// under the batch lock, that the batch should still be flushed. If the batch cannot be handed over its events are
+// put back ahead of any added since.
+func (a *Auditor) flushBatch(ctx context.Context, flush func() bool) error {
+	b := a.batch
+	select {
+	case b.sending <- struct{}{}:
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+	defer func() { <-b.sending }()
+
+	b.mu.Lock()
+	if !flush() {
+		b.mu.Unlock()
+		return nil
+	}
+	taken, size := b.pending, b.size
+	b.pending, b.size = nil, 0
+	b.generation++
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	messages := make([][]byte, 0, len(taken))
+	for _, e := range taken {
+		messages = append(messages, e.message)
+	}
+	err := a.enqueue(ctx, encodeBatch(messages))
+	if err != nil {
+		b.mu.Lock()
+		b.pending = append(taken, b.pending...)
+		b.size += size
+		a.lingerLater()
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// holds reports whether the event with the given id is waiting in the batch. The caller must hold the batch lock.
+func (b *batch) holds(id uint64) bool {
+	for _, e := range b.pending {
+		if e.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// remove takes the event with the given id out of the batch, if it is there. The caller must hold the batch lock.
+func (b *batch) remove(id uint64) {
+	for i, e := range b.pending {
+		if e.id == id {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			b.size -= len(e.message)
+			return
+		}
+	}
+}
+
+// encodeBatch returns the batch schema encoding of a batch of events already encoded with the matching event schema.
+// An avro array is written as a count followed by its items, and then a zero count to end it.
+func encodeBatch(messages [][]byte) []byte {
+	size := binary.MaxVarintLen64 + 1
+	for _, m := range messages {
+		size += len(m)
+	}
+
+	b := make([]byte, 0, size)
+	if len(messages) > 0 {
+		b = binary.AppendVarint(b, int64(len(messages)))
+		for _, m := range messages {
+			b = append(b, m...)
+		}
+	}
+	return append(b, 0)
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// readBatch waits for the next message on output and decodes it as a batch
+func readBatch(t *testing.T, output chan []byte) EventBatch {
+	var b EventBatch
+	select {
+	case message := <-output:
+		So(EventBatchSchema.Unmarshal(message, &b), ShouldBeNil)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a batch to be flushed")
+	}
+	return b
+}
+
+func results(b EventBatch) []string {
+	var r []string
+	for _, e := range b.Events {
+		r = append(r, e.ActionResult)
+	}
+	return r
+}
+
+func TestAuditor_RecordBatched(t *testing.T) {
+	Convey("given a producer", t, func() {
+		output := make(chan []byte, 10)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+
+		Convey("when an auditor batches a number of events", func() {
+			auditor := NewWithDelivery(producer, service, DeliveryConfig{Batch: BatchConfig{MaxEvents: 2}})
+
+			Convey("then the batch is only sent once it is full", func() {
+				So(auditor.Record(setUpContext(), auditAction, Attempted, common.Params{"ID": "1"}), ShouldBeNil)
+				So(output, ShouldBeEmpty)
+				So(auditor.Record(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+
+				b := readBatch(t, output)
+				So(results(b), ShouldResemble, []string{Attempted, Successful})
+				So(b.Events[0].User, ShouldEqual, user)
+				So(b.Events[0].Params, ShouldResemble, common.Params{"ID": "1"})
+			})
+
+			Convey("then a partial batch is sent when the auditor is closed", func() {
+				So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+				So(auditor.Close(context.Background()), ShouldBeNil)
+				So(results(readBatch(t, output)), ShouldResemble, []string{Attempted})
+
+				err := auditor.Record(setUpContext(), auditAction, Successful, nil)
+				So(err, ShouldResemble, NewAuditError(errAuditorClosed.Error(), auditAction, Successful, nil))
+			})
+		})
+
+		Convey("when an auditor batches a number of bytes", func() {
+			message, err := EventSchema.Marshal(Event{Service: service, User: user, AttemptedAction: auditAction,
+				ActionResult: Attempted, Created: time.Now().String()})
+			So(err, ShouldBeNil)
+			auditor := NewWithDelivery(producer, service, DeliveryConfig{Batch: BatchConfig{MaxBytes: len(message) * 5 / 2}})
+
+			Convey("then the batch is sent once it reaches that size", func() {
+				So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+				So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+				So(output, ShouldBeEmpty)
+				So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+				So(readBatch(t, output).Events, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("when an auditor batches for a linger time", func() {
+			auditor := NewWithDelivery(producer, service, DeliveryConfig{Batch: BatchConfig{MaxEvents: 100, Linger: 20 * time.Millisecond}})
+			defer auditor.Close(context.Background())
+
+			Convey("then a batch that does not fill up is sent once the linger time has passed", func() {
+				So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+				So(auditor.Record(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+				So(results(readBatch(t, output)), ShouldResemble, []string{Attempted, Successful})
+
+				So(auditor.Record(setUpContext(), auditAction, Unsuccessful, nil), ShouldBeNil)
+				So(results(readBatch(t, output)), ShouldResemble, []string{Unsuccessful})
+			})
+		})
+	})
+
+	Convey("given a producer that is not reading its output channel", t, func() {
+		output := make(chan []byte)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+		auditor := NewWithDelivery(producer, service, DeliveryConfig{Timeout: 20 * time.Millisecond, Batch: BatchConfig{MaxEvents: 2}})
+
+		Convey("then the event that fills the batch fails and the earlier events are kept", func() {
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+			err := auditor.Record(setUpContext(), auditAction, Successful, nil)
+			So(err, ShouldResemble, NewAuditError(errDeliveryTimeout.Error(), auditAction, Successful, nil))
+
+			recorded := make(chan error, 1)
+			go func() {
+				recorded <- auditor.Record(setUpContext(), auditAction, Unsuccessful, nil)
+			}()
+			So(results(readBatch(t, output)), ShouldResemble, []string{Attempted, Unsuccessful})
+			So(<-recorded, ShouldBeNil)
+		})
+	})
+}
+
+func TestAuditor_RecordBatchedToStalledProducer(t *testing.T) {
+	Convey("given an auditor lingering over batches for a producer that has stopped reading", t, func() {
+		output := make(chan []byte)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+		auditor := NewWithDelivery(producer, service, DeliveryConfig{Batch: BatchConfig{MaxEvents: 2, Linger: 10 * time.Millisecond}})
+		So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+		// let the linger timer start a flush that cannot finish
+		time.Sleep(50 * time.Millisecond)
+
+		Convey("then events can still be added to the next batch", func() {
+			ctx, cancel := context.WithTimeout(setUpContext(), 100*time.Millisecond)
+			defer cancel()
+			So(auditor.Record(ctx, auditAction, Successful, nil), ShouldBeNil)
+
+			Convey("and an event that fills it gives up when its context is done", func() {
+				start := time.Now()
+				err := auditor.Record(ctx, auditAction, Unsuccessful, nil)
+				So(err, ShouldResemble, NewAuditError(errDeliveryTimeout.Error(), auditAction, Unsuccessful, nil))
+				So(time.Since(start), ShouldBeLessThan, time.Second)
+			})
+		})
+
+		Convey("then Close gives up on the last batch when its context is done", func() {
+			So(auditor.Record(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			So(auditor.Close(ctx), ShouldNotBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+
+			So(auditor.Record(setUpContext(), auditAction, Unsuccessful, nil), ShouldNotBeNil)
+			So(auditor.batch.pending, ShouldHaveLength, 2)
+		})
+	})
+}
+
+func TestEncodeBatch(t *testing.T) {
+	Convey("an empty batch decodes to no events", t, func() {
+		var b EventBatch
+		So(EventBatchSchema.Unmarshal(encodeBatch(nil), &b), ShouldBeNil)
+		So(b.Events, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,257 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// errUnsignableSchema is returned when an auditor that signs events would send them without every field that is signed
+var errUnsignableSchema = errors.New("signed events must be sent with EventV2Schema, which has every field of the event")
+
+// Signer links the events recorded by an Auditor into a tamper-evident chain. Each event is given the id of the chain,
+// the next sequence number and the signature of the event before it, and is then signed with an HMAC of the whole
+// event, so that a Verifier holding the key can tell if any event was altered, dropped or moved.
+type Signer struct {
+	key     []byte
+	chainID string
+
+	mu       sync.Mutex
+	sequence int64
+	previous string
+}
+
+// NewSigner returns a Signer that starts a new chain, signing events with key
+func NewSigner(key []byte) (*Signer, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Signer{key: key, chainID: hex.EncodeToString(id)}, nil
+}
+
+// SignWith makes the auditor sign every event it records with signer. Events are signed and handed over one at a time,
+// so that they reach the producer or sink in the order of their sequence numbers. Signatures cover every field of the
+// event, so an auditor sending events to a producer must use EventV2Schema, and an error is returned if it does not.
+func (a *Auditor) SignWith(signer *Signer) error {
+	if err := a.signable(); err != nil {
+		return err
+	}
+	a.signer = signer
+	return nil
+}
+
+// signable returns an error unless the events the auditor sends have every field of the event. Sinks are given the
+// whole event.
+func (a *Auditor) signable() error {
+	if a.sink == nil && a.schema != EventV2Schema {
+		return errUnsignableSchema
+	}
+	return nil
+}
+
+// chain adds the next link in the chain to e and calls deliver with it, only moving the chain on if deliver succeeds
+func (s *Signer) chain(e *Event, deliver func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ChainID = s.chainID
+	e.Sequence = s.sequence + 1
+	e.PreviousDigest = s.previous
+	signature, err := sign(s.key, *e)
+	if err != nil {
+		return NewAuditError("error signing event: "+err.Error(), e.AttemptedAction, e.ActionResult, e.Params)
+	}
+	e.Signature = signature
+
+	if err := deliver(); err != nil {
+		return err
+	}
+	s.sequence, s.previous = e.Sequence, e.Signature
+	return nil
+}
+
+// sign returns the hex encoded HMAC of e without its signature. Every field is signed, whichever schema the event is
+// sent with, by encoding it with EventV2Schema.
+func sign(key []byte, e Event) (string, error) {
+	e.Signature = ""
+	b, err := EventV2Schema.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ProblemKind identifies what is wrong with a chain of audit events
+type ProblemKind string
+
+// Problems found by a Verifier
+const (
+	// Unsigned events have no signature
+	Unsigned ProblemKind = "unsigned"
+	// Tampered events were altered after they were signed, or do not follow on from the event before them
+	Tampered ProblemKind = "tampered"
+	// Missing events were never seen
+	Missing ProblemKind = "missing"
+	// Reordered events arrived after events that followed them
+	Reordered ProblemKind = "reordered"
+	// Duplicate events were seen more than once
+	Duplicate ProblemKind = "duplicate"
+)
+
+// Problem describes an event of a chain that could not be verified
+type Problem struct {
+	Kind     ProblemKind
+	ChainID  string
+	Sequence int64
+	Detail   string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s event %d in chain %s: %s", p.Kind, p.Sequence, p.ChainID, p.Detail)
+}
+
+// chainState is what a Verifier knows about a chain from the events it has seen
+type chainState struct {
+	// start is the sequence number before the first event seen, and every event from start to floor has been seen
+	start, floor int64
+	// last is the highest sequence number seen, and digest its signature
+	last   int64
+	digest string
+	// missing holds the sequence numbers not yet seen below last, with the signature the following event expects
+	// them to have, if that event has been seen
+	missing map[int64]string
+	// seen holds the sequence numbers seen above floor, or at or below start
+	seen map[int64]bool
+}
+
+// hasSeen reports whether the event with sequence number n has been seen
+func (c *chainState) hasSeen(n int64) bool {
+	return c.seen[n] || n > c.start && n <= c.floor
+}
+
+// markSeen records that the event with sequence number n has been seen, moving floor up past it if it can
+func (c *chainState) markSeen(n int64) {
+	c.seen[n] = true
+	for c.seen[c.floor+1] {
+		delete(c.seen, c.floor+1)
+		c.floor++
+	}
+}
+
+// Verifier checks the events of one or more chains, written by Auditors with a Signer, as they are read. A chain is
+// verified from the first of its events the Verifier sees, so a stream that starts part way through a chain is not a
+// problem.
+type Verifier struct {
+	key      []byte
+	chains   map[string]*chainState
+	problems []Problem
+}
+
+// NewVerifier returns a Verifier for events signed with key
+func NewVerifier(key []byte) *Verifier {
+	return &Verifier{key: key, chains: make(map[string]*chainState)}
+}
+
+// VerifyEvents checks a stream of events signed with key, returning every problem found
+func VerifyEvents(key []byte, events []Event) []Problem {
+	v := NewVerifier(key)
+	for _, e := range events {
+		v.Check(e)
+	}
+	return v.Problems()
+}
+
+// Check verifies the next event of the stream
+func (v *Verifier) Check(e Event) {
+	if e.Signature == "" {
+		v.report(Unsigned, e, "event has no signature")
+		return
+	}
+	expected, err := sign(v.key, e)
+	if err != nil {
+		v.report(Tampered, e, fmt.Sprintf("event cannot be encoded: %v", err))
+		return
+	}
+	if !hmac.Equal([]byte(expected), []byte(e.Signature)) {
+		v.report(Tampered, e, "signature does not match the event")
+		return
+	}
+
+	c, ok := v.chains[e.ChainID]
+	if !ok {
+		start := e.Sequence - 1
+		c = &chainState{start: start, floor: start, last: start, digest: e.PreviousDigest,
+			missing: make(map[int64]string), seen: make(map[int64]bool)}
+		v.chains[e.ChainID] = c
+	}
+
+	switch {
+	case c.hasSeen(e.Sequence):
+		v.report(Duplicate, e, "event has already been seen")
+		return
+	case e.Sequence <= c.last:
+		next, ok := c.missing[e.Sequence]
+		if !ok {
+			v.report(Reordered, e, "event arrived after events that followed it, before the verifier saw its chain")
+			c.markSeen(e.Sequence)
+			return
+		}
+		delete(c.missing, e.Sequence)
+		v.report(Reordered, e, fmt.Sprintf("event arrived after event %d", c.last))
+		if next != "" && next != e.Signature {
+			v.report(Tampered, e, "event is not the one the following event was chained to")
+		}
+	case e.Sequence == c.last+1:
+		if e.PreviousDigest != c.digest {
+			v.report(Tampered, e, "previous digest does not match the event before it")
+		}
+		c.last, c.digest = e.Sequence, e.Signature
+	default:
+		for missing := c.last + 1; missing < e.Sequence; missing++ {
+			c.missing[missing] = ""
+		}
+		c.missing[e.Sequence-1] = e.PreviousDigest
+		c.last, c.digest = e.Sequence, e.Signature
+	}
+
+	c.markSeen(e.Sequence)
+	if previous, ok := c.missing[e.Sequence-1]; ok && previous == "" {
+		c.missing[e.Sequence-1] = e.PreviousDigest
+	}
+}
+
+// Problems returns every problem found so far, followed by the events of each chain that have not been seen
+func (v *Verifier) Problems() []Problem {
+	problems := append([]Problem(nil), v.problems...)
+
+	ids := make([]string, 0, len(v.chains))
+	for id := range v.chains {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		missing := make([]int64, 0, len(v.chains[id].missing))
+		for sequence := range v.chains[id].missing {
+			missing = append(missing, sequence)
+		}
+		sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+		for _, sequence := range missing {
+			problems = append(problems, Problem{Kind: Missing, ChainID: id, Sequence: sequence, Detail: "event was not seen"})
+		}
+	}
+	return problems
+}
+
+func (v *Verifier) report(kind ProblemKind, e Event, detail string) {
+	v.problems = append(v.problems, Problem{Kind: kind, ChainID: e.ChainID, Sequence: e.Sequence, Detail: detail})
+}
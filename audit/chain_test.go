@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var chainKey = []byte("chain-key")
+
+// signedEvents records n events with a signing auditor and returns them in the order they were written
+func signedEvents(n int) []Event {
+	var events []Event
+	auditor := NewWithSink(sinkFunc(func(ctx context.Context, e Event) error {
+		events = append(events, e)
+		return nil
+	}), service)
+
+	signer, err := NewSigner(chainKey)
+	So(err, ShouldBeNil)
+	So(auditor.SignWith(signer), ShouldBeNil)
+
+	for i := 0; i < n; i++ {
+		So(auditor.Record(setUpContext(), auditAction, Successful, common.Params{"ID": "12345"}), ShouldBeNil)
+	}
+	return events
+}
+
+func kinds(problems []Problem) []ProblemKind {
+	var k []ProblemKind
+	for _, p := range problems {
+		k = append(k, p.Kind)
+	}
+	return k
+}
+
+func TestAuditor_SignWith(t *testing.T) {
+	Convey("given an auditor with a signer", t, func() {
+		events := signedEvents(3)
+
+		Convey("then each event follows on from the one before it", func() {
+			So(events, ShouldHaveLength, 3)
+			for i, e := range events {
+				So(e.ChainID, ShouldEqual, events[0].ChainID)
+				So(e.Sequence, ShouldEqual, i+1)
+				So(e.Signature, ShouldNotBeEmpty)
+				if i > 0 {
+					So(e.PreviousDigest, ShouldEqual, events[i-1].Signature)
+				}
+			}
+			So(events[0].PreviousDigest, ShouldBeEmpty)
+		})
+
+		Convey("then a failed delivery does not move the chain on", func() {
+			var delivered []Event
+			fail := true
+			auditor := NewWithSink(sinkFunc(func(ctx context.Context, e Event) error {
+				if fail {
+					return context.DeadlineExceeded
+				}
+				delivered = append(delivered, e)
+				return nil
+			}), service)
+			signer, _ := NewSigner(chainKey)
+			So(auditor.SignWith(signer), ShouldBeNil)
+
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldNotBeNil)
+			fail = false
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+			So(delivered[0].Sequence, ShouldEqual, 1)
+			So(VerifyEvents(chainKey, delivered), ShouldBeEmpty)
+		})
+
+		Convey("then events sent to a producer with the v1 schema are not signed, as it leaves out signed fields", func() {
+			output := make(chan []byte, 1)
+			auditor := New(&OutboundProducerMock{OutputFunc: func() chan []byte { return output }}, service)
+			signer, _ := NewSigner(chainKey)
+			So(auditor.SignWith(signer), ShouldEqual, errUnsignableSchema)
+
+			auditor.UseSchema(EventV2Schema)
+			So(auditor.SignWith(signer), ShouldBeNil)
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+
+			var e Event
+			So(EventV2Schema.Unmarshal(<-output, &e), ShouldBeNil)
+			So(VerifyEvents(chainKey, []Event{e}), ShouldBeEmpty)
+
+			auditor.UseSchema(EventSchema)
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldNotBeNil)
+			So(output, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestVerifyEvents(t *testing.T) {
+	Convey("given a chain of signed events", t, func() {
+		events := signedEvents(4)
+
+		Convey("then an intact chain has no problems", func() {
+			So(VerifyEvents(chainKey, events), ShouldBeEmpty)
+		})
+
+		Convey("then a chain read from part way through has no problems", func() {
+			So(VerifyEvents(chainKey, events[2:]), ShouldBeEmpty)
+		})
+
+		Convey("then events signed with another key are reported as tampered", func() {
+			So(kinds(VerifyEvents([]byte("other-key"), events[:1])), ShouldResemble, []ProblemKind{Tampered})
+		})
+
+		Convey("then an altered event is reported as tampered", func() {
+			events[1].User = "someone-else"
+			problems := VerifyEvents(chainKey, events)
+			So(kinds(problems), ShouldResemble, []ProblemKind{Tampered, Missing})
+			So(problems[0].Sequence, ShouldEqual, 2)
+		})
+
+		Convey("then an altered field added in v2 is reported as tampered", func() {
+			events[1].ClientIP = "10.0.0.1"
+			So(kinds(VerifyEvents(chainKey, events)), ShouldResemble, []ProblemKind{Tampered, Missing})
+		})
+
+		Convey("then an unsigned event is reported", func() {
+			events[1].Signature = ""
+			So(kinds(VerifyEvents(chainKey, events)), ShouldResemble, []ProblemKind{Unsigned, Missing})
+		})
+
+		Convey("then a dropped event is reported as missing", func() {
+			problems := VerifyEvents(chainKey, append(events[:1:1], events[2:]...))
+			So(problems, ShouldResemble, []Problem{
+				{Kind: Missing, ChainID: events[0].ChainID, Sequence: 2, Detail: "event was not seen"},
+			})
+		})
+
+		Convey("then swapped events are reported as reordered", func() {
+			events[1], events[2] = events[2], events[1]
+			problems := VerifyEvents(chainKey, events)
+			So(kinds(problems), ShouldResemble, []ProblemKind{Reordered})
+			So(problems[0].Sequence, ShouldEqual, 2)
+		})
+
+		Convey("then a repeated event is reported as a duplicate", func() {
+			problems := VerifyEvents(chainKey, append(events, events[1]))
+			So(kinds(problems), ShouldResemble, []ProblemKind{Duplicate})
+			So(problems[0].Sequence, ShouldEqual, 2)
+		})
+
+		Convey("then only the events seen out of order are remembered to find duplicates", func() {
+			v := NewVerifier(chainKey)
+			v.Check(events[0])
+			v.Check(events[2])
+			So(v.chains[events[0].ChainID].seen, ShouldHaveLength, 1)
+
+			v.Check(events[1])
+			v.Check(events[3])
+			So(v.chains[events[0].ChainID].seen, ShouldBeEmpty)
+
+			v.Check(events[2])
+			So(kinds(v.Problems()), ShouldResemble, []ProblemKind{Reordered, Duplicate})
+		})
+
+		Convey("then an event replaced by another with the same sequence is reported as tampered", func() {
+			other := signedEvents(2)[1]
+			other.ChainID, other.PreviousDigest = events[0].ChainID, events[0].Signature
+			other.Signature, _ = sign(chainKey, other)
+			problems := VerifyEvents(chainKey, []Event{events[0], events[2], other, events[3]})
+			So(kinds(problems), ShouldResemble, []ProblemKind{Reordered, Tampered})
+		})
+	})
+}
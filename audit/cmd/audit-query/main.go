@@ -0,0 +1,134 @@
+// Command audit-query prints the audit events in avro files, or read from stdin, that match the given filters. For
+// example, to find who changed a dataset in the last week:
+//
+//	audit-query -param dataset_id=cpih01 -result successful -from 2024-05-01T00:00:00Z events.avro
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/audit/query"
+	"github.com/ONSdigital/go-ns/avro"
+)
+
+// listFlag collects the values of a flag that can be given more than once, or as a comma separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, strings.Split(value, ",")...)
+	return nil
+}
+
+// paramFlag collects key=value params
+type paramFlag map[string]string
+
+func (p paramFlag) String() string {
+	return fmt.Sprint(map[string]string(p))
+}
+
+func (p paramFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("param %q must be key=value", value)
+	}
+	p[k] = v
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "audit-query:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	var filter query.Filter
+	params := paramFlag{}
+	var from, to string
+
+	flags := flag.NewFlagSet("audit-query", flag.ContinueOnError)
+	flags.Var((*listFlag)(&filter.Users), "user", "only events by these users")
+	flags.Var((*listFlag)(&filter.Services), "service", "only events recorded by these services")
+	flags.Var((*listFlag)(&filter.Actions), "action", "only events for these actions")
+	flags.Var((*listFlag)(&filter.Results), "result", "only events with these results")
+	flags.Var(params, "param", "only events with this key=value param")
+	flags.StringVar(&from, "from", "", "only events at or after this RFC 3339 time")
+	flags.StringVar(&to, "to", "", "only events at or before this RFC 3339 time")
+	format := flags.String("format", query.Table, "output format: table, jsonl, csv or avro")
+	v2 := flags.Bool("v2", false, "events are encoded with the v2 event schema")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter.Params = params
+	var err error
+	if filter.From, err = parseTime(from); err != nil {
+		return err
+	}
+	if filter.To, err = parseTime(to); err != nil {
+		return err
+	}
+
+	schema := audit.EventSchema
+	if *v2 {
+		schema = audit.EventV2Schema
+	}
+
+	w, err := query.NewWriter(*format, stdout, schema)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		err = find(stdin, schema, filter, w)
+	}
+	for _, path := range flags.Args() {
+		if err = findInFile(path, schema, filter, w); err != nil {
+			break
+		}
+	}
+
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func findInFile(path string, schema *avro.Schema, filter query.Filter, w query.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := find(f, schema, filter, w); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func find(r io.Reader, schema *avro.Schema, filter query.Filter, w query.Writer) error {
+	reader, err := query.NewReader(r, schema)
+	if err != nil {
+		return err
+	}
+	return query.Find(reader, filter, w.Write)
+}
@@ -0,0 +1,277 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ONSdigital/go-ns/common"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Causes of the errors returned when an event cannot be handed to the producer
+var (
+	errDeliveryTimeout   = errors.New("timed out waiting to send audit event")
+	errDeliveryCancelled = errors.New("request cancelled before audit event was sent")
+	errAuditorClosed     = errors.New("auditor is closed")
+)
+
+// DefaultSpoolTimeout is the delivery timeout of auditors with a spool but no Timeout, after which events that cannot
+// be handed over are spooled
+const DefaultSpoolTimeout = time.Second
+
+// ConfirmingProducer is an OutboundProducer that can confirm each message it sends. Auditors use it for
+// RecordConfirmed, so that handlers which must not go ahead without an audit trail only do so once the event has
+// actually been sent.
+type ConfirmingProducer interface {
+	OutboundProducer
+	// Send sends message and returns once it has been delivered, or could not be
+	Send(ctx context.Context, message []byte) error
+}
+
+// DeliveryConfig sets how an Auditor hands events to its producer
+type DeliveryConfig struct {
+	// BufferSize is the number of events held in memory while the producer is busy. When it is full Record waits
+	// for room. Zero hands each event to the producer directly.
+	BufferSize int
+	// Timeout is the longest a call to Record or RecordConfirmed waits to hand over or confirm an event, on top of
+	// any deadline of the request context. Zero waits for as long as the context allows, unless there is a Spool, in
+	// which case DefaultSpoolTimeout is used.
+	Timeout time.Duration
+	// Spool, if set, keeps events that Record cannot hand over in time on disk, and replays them in the background
+	// once the producer accepts events again. Events recorded while there are events in the spool are added to it
+	// so that they are sent in order, so Record may wait for the hand-over of one event before it to time out. The
+	// spool must be closed separately once the auditor has been closed.
+	Spool *Spool
+	// Batch, if any of its limits are set, groups events into batches that are each sent as a single message
+	// encoded with EventBatchSchema, rather than sending one message per event. Record returns once the event has
+	// been added to a batch, or, if it fills the batch, once the batch has been handed over.
+	Batch BatchConfig
+}
+
+// NewWithDelivery creates a new Auditor that delivers events to the producer as set by config. Auditors with a
+// buffer, spool or batches send events in the background and must be closed once they are no longer needed.
+func NewWithDelivery(producer OutboundProducer, namespace string, config DeliveryConfig) *Auditor {
+	a := New(producer, namespace)
+	if config.Spool != nil && config.Timeout <= 0 {
+		config.Timeout = DefaultSpoolTimeout
+	}
+	a.delivery = config
+
+	if config.BufferSize == 0 && config.Spool == nil && !config.Batch.enabled() {
+		return a
+	}
+
+	if config.Batch.enabled() {
+		a.batch = newBatch()
+	}
+	a.closing = make(chan struct{})
+	a.abandoned = make(chan struct{})
+	a.done = make(chan struct{})
+	if config.BufferSize > 0 {
+		a.queue = make(chan []byte, config.BufferSize)
+		a.workers.Add(1)
+		go a.run()
+	}
+	if config.Spool != nil {
+		a.workers.Add(1)
+		go a.replay()
+	}
+	go func() {
+		a.workers.Wait()
+		close(a.done)
+	}()
+	return a
+}
+
+// RecordConfirmed records an audit event in the same way as Record, but only returns once the producer has sent it.
+// If the producer is not a ConfirmingProducer the event is confirmed once the producer has taken it from its
+// output channel. Events are never buffered or batched, so those recorded earlier with Record may arrive afterwards.
+func (a *Auditor) RecordConfirmed(ctx context.Context, attemptedAction string, actionResult string, params common.Params) error {
+	return a.record(ctx, attemptedAction, actionResult, params, true)
+}
+
+// Close stops the auditor accepting events, flushes the current batch and waits for the events already buffered to be
+// handed to the producer, or to the spool if there is one. Other flushes of batches still waiting on the producer give
+// up first, leaving their events to the last batch. It returns an error if the batch cannot be flushed, or the
+// context's error if the events are not all sent before the context is done, in which case buffered events that the
+// producer has not taken are logged and dropped.
+func (a *Auditor) Close(ctx context.Context) error {
+	if a.closing == nil {
+		return nil
+	}
+
+	var batchErr error
+	if a.batch != nil {
+		batchErr = a.closeBatch(ctx)
+	}
+
+	// events waiting for room in the buffer give up before it is closed
+	a.closeOnce.Do(func() { close(a.closing) })
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		if a.queue != nil {
+			close(a.queue)
+		}
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return batchErr
+	case <-ctx.Done():
+		// events the producer has not taken by now are dropped, so that nothing is left waiting on it for good
+		a.abandonOnce.Do(func() { close(a.abandoned) })
+		return ctx.Err()
+	}
+}
+
+// run hands buffered events to the producer until the auditor is closed and the buffer is empty
+func (a *Auditor) run() {
+	defer a.workers.Done()
+	for message := range a.queue {
+		if a.delivery.Spool == nil {
+			select {
+			case a.producer.Output() <- message:
+			case <-a.abandoned:
+				log.Error(context.Background(), "dropped buffered audit event", errAuditorClosed,
+					log.Data{"reason": "the producer did not take the event before the auditor was closed"})
+			}
+			continue
+		}
+
+		select {
+		case a.producer.Output() <- message:
+		case <-a.closing:
+			// events still buffered when the auditor is closed are kept for the next process to send
+			if err := a.delivery.Spool.Append(message); err != nil {
+				log.Error(context.Background(), "failed to spool buffered audit event", err)
+			}
+		}
+	}
+}
+
+// replay sends spooled events to the producer whenever there are any, until the auditor is closed
+func (a *Auditor) replay() {
+	defer a.workers.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-a.closing
+		cancel()
+	}()
+
+	spool := a.delivery.Spool
+	for {
+		err := spool.Replay(ctx, func(ctx context.Context, message []byte) error {
+			select {
+			case a.producer.Output() <- message:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Error(ctx, "failed to replay spooled audit events", err)
+		}
+
+		select {
+		case <-spool.notify:
+		case <-a.closing:
+			return
+		}
+	}
+}
+
+// deliver hands message to the producer, or to the batch, buffer or spool if the auditor has them
+func (a *Auditor) deliver(ctx context.Context, message []byte, confirm bool) error {
+	select {
+	case <-a.closing:
+		return errAuditorClosed
+	default:
+	}
+
+	if a.delivery.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.delivery.Timeout)
+		defer cancel()
+	}
+
+	if confirm {
+		return a.confirm(ctx, message)
+	}
+	if a.batch != nil {
+		return a.addToBatch(ctx, message)
+	}
+	return a.enqueue(ctx, message)
+}
+
+// enqueue hands message to the producer, or to the buffer or spool if the auditor has them
+func (a *Auditor) enqueue(ctx context.Context, message []byte) error {
+	spool := a.delivery.Spool
+	if spool == nil {
+		return a.handOver(ctx, message)
+	}
+
+	// an event is only handed over once any before it have been spooled, so that it cannot overtake them
+	a.spooling.Lock()
+	defer a.spooling.Unlock()
+	if spool.Depth() > 0 {
+		return spool.Append(message)
+	}
+
+	err := a.handOver(ctx, message)
+	if err == errDeliveryTimeout || err == errDeliveryCancelled {
+		return spool.Append(message)
+	}
+	return err
+}
+
+// confirm sends message directly to the producer, waiting until it is sent
+func (a *Auditor) confirm(ctx context.Context, message []byte) error {
+	if p, ok := a.producer.(ConfirmingProducer); ok {
+		if err := p.Send(ctx, message); err != nil {
+			return fmt.Errorf("producer failed to send audit event: %v", err)
+		}
+		return nil
+	}
+	return a.send(ctx, a.producer.Output(), message)
+}
+
+// handOver hands message to the producer, or to the buffer if there is one
+func (a *Auditor) handOver(ctx context.Context, message []byte) error {
+	if a.queue == nil {
+		return a.send(ctx, a.producer.Output(), message)
+	}
+
+	// the read lock stops the buffer being closed while the event is added to it
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return errAuditorClosed
+	}
+	return a.send(ctx, a.queue, message)
+}
+
+// send writes message to output, giving up when ctx is done or the auditor is closed
+func (a *Auditor) send(ctx context.Context, output chan []byte, message []byte) error {
+	select {
+	case output <- message:
+		return nil
+	case <-a.closing:
+		return errAuditorClosed
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+// contextError returns the cause of the error for an event that could not be sent before ctx was done
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.Canceled {
+		return errDeliveryCancelled
+	}
+	return errDeliveryTimeout
+}
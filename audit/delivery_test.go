@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuditor_RecordDeliveryTimeout(t *testing.T) {
+	Convey("given a producer that is not reading its output channel", t, func() {
+		output := make(chan []byte)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+
+		Convey("then Record gives up once the delivery timeout has passed", func() {
+			auditor := NewWithDelivery(producer, service, DeliveryConfig{Timeout: 20 * time.Millisecond})
+
+			err := auditor.Record(setUpContext(), auditAction, Successful, nil)
+			So(err, ShouldResemble, NewAuditError(errDeliveryTimeout.Error(), auditAction, Successful, nil))
+		})
+
+		Convey("then Record gives up when the request is cancelled", func() {
+			auditor := New(producer, service)
+
+			ctx, cancel := context.WithCancel(setUpContext())
+			cancel()
+
+			err := auditor.Record(ctx, auditAction, Successful, nil)
+			So(err, ShouldResemble, NewAuditError(errDeliveryCancelled.Error(), auditAction, Successful, nil))
+		})
+	})
+}
+
+func TestAuditor_RecordBuffered(t *testing.T) {
+	Convey("given an auditor with a buffer", t, func() {
+		output := make(chan []byte)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+		auditor := NewWithDelivery(producer, service, DeliveryConfig{BufferSize: 1, Timeout: 50 * time.Millisecond})
+
+		Convey("when the producer is busy events are held until the buffer is full", func() {
+			// one event waits for the producer and the other in the buffer
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+			So(auditor.Record(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+
+			err := auditor.Record(setUpContext(), auditAction, Unsuccessful, nil)
+			So(err, ShouldResemble, NewAuditError(errDeliveryTimeout.Error(), auditAction, Unsuccessful, nil))
+
+			Convey("and they are sent in order once the producer catches up", func() {
+				for _, result := range []string{Attempted, Successful} {
+					var e Event
+					So(EventSchema.Unmarshal(<-output, &e), ShouldBeNil)
+					So(e.ActionResult, ShouldEqual, result)
+				}
+				So(auditor.Close(context.Background()), ShouldBeNil)
+			})
+		})
+
+		Convey("when the auditor is closed", func() {
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			Convey("then Close waits for buffered events to be sent", func() {
+				go func() { <-output }()
+				So(auditor.Close(context.Background()), ShouldBeNil)
+			})
+
+			Convey("then buffered events the producer does not take before Close gives up are dropped", func() {
+				So(errors.Is(auditor.Close(ctx), context.DeadlineExceeded), ShouldBeTrue)
+
+				// nothing is left waiting to send to the producer
+				So(auditor.Close(context.Background()), ShouldBeNil)
+				select {
+				case <-output:
+					So("an event was still being sent", ShouldBeEmpty)
+				default:
+				}
+			})
+
+			Convey("then no more events are accepted", func() {
+				go func() { <-output }()
+				So(auditor.Close(context.Background()), ShouldBeNil)
+
+				err := auditor.Record(setUpContext(), auditAction, Successful, nil)
+				So(err, ShouldResemble, NewAuditError(errAuditorClosed.Error(), auditAction, Successful, nil))
+			})
+		})
+	})
+}
+
+func TestAuditor_RecordConfirmed(t *testing.T) {
+	Convey("given a producer that confirms each message", t, func() {
+		producer := &ConfirmingProducerMock{
+			SendFunc: func(ctx context.Context, message []byte) error { return nil },
+		}
+		auditor := NewWithDelivery(producer, service, DeliveryConfig{BufferSize: 10})
+		defer auditor.Close(context.Background())
+
+		Convey("then RecordConfirmed sends the event directly to the producer", func() {
+			err := auditor.RecordConfirmed(setUpContext(), auditAction, Successful, common.Params{"ID": "12345"})
+			So(err, ShouldBeNil)
+
+			So(producer.SendCalls(), ShouldHaveLength, 1)
+			So(producer.OutputCalls(), ShouldHaveLength, 0)
+
+			var e Event
+			So(EventSchema.Unmarshal(producer.SendCalls()[0].Message, &e), ShouldBeNil)
+			So(e.Params, ShouldResemble, common.Params{"ID": "12345"})
+		})
+
+		Convey("then RecordConfirmed returns an error if the producer could not send the event", func() {
+			producer.SendFunc = func(ctx context.Context, message []byte) error {
+				return errors.New("broker unavailable")
+			}
+
+			err := auditor.RecordConfirmed(setUpContext(), auditAction, Successful, nil)
+			expectedErr := NewAuditError("producer failed to send audit event: broker unavailable", auditAction, Successful, nil)
+			So(err, ShouldResemble, expectedErr)
+		})
+	})
+
+	Convey("given a producer that cannot confirm messages", t, func() {
+		output := make(chan []byte, 1)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+		auditor := New(producer, service)
+
+		Convey("then RecordConfirmed returns once the producer has the event", func() {
+			So(auditor.RecordConfirmed(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+			So(output, ShouldHaveLength, 1)
+		})
+	})
+}
@@ -31,7 +31,7 @@ func GetParameters(ctx context.Context, path string, vars map[string]string) com
 	}
 	numberOfSegments := len(pathSegments)
 
-	if pathSegments[0] == "hierarchies" {
+	if numberOfSegments > 0 && pathSegments[0] == "hierarchies" {
 		if numberOfSegments > 1 {
 			auditParams["instance_id"] = pathSegments[1]
 
@@ -47,13 +47,17 @@ func GetParameters(ctx context.Context, path string, vars map[string]string) com
 		return auditParams
 	}
 
-	if pathSegments[0] == "search" {
+	if numberOfSegments > 0 && pathSegments[0] == "search" {
 		pathSegments = pathSegments[1:]
 	}
 
 	for key, value := range vars {
 		if key == "id" {
-			auditParams[pathIDs[pathSegments[0]]] = value
+			// ids of paths without a known first segment keep the name of the var
+			if len(pathSegments) > 0 && pathIDs[pathSegments[0]] != "" {
+				key = pathIDs[pathSegments[0]]
+			}
+			auditParams[key] = value
 		} else {
 			auditParams[key] = value
 		}
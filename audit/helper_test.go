@@ -208,3 +208,74 @@ func TestGetParameters(t *testing.T) {
 		})
 	})
 }
+
+func TestGetParametersUnknownPaths(t *testing.T) {
+	Convey("Given an id var for a path without a known first segment", t, func() {
+		auditParams := GetParameters(context.Background(), "/filters/abc", map[string]string{"id": "abc"})
+
+		Convey("Then the id keeps the name of the var", func() {
+			So(auditParams, ShouldResemble, common.Params{"id": "abc"})
+		})
+	})
+
+	Convey("Given an empty path", t, func() {
+		Convey("Then GetParameters does not panic", func() {
+			So(GetParameters(context.Background(), "", map[string]string{"id": "abc"}), ShouldResemble, common.Params{"id": "abc"})
+			So(GetParameters(context.Background(), "/search", map[string]string{"id": "abc"}), ShouldResemble, common.Params{"id": "abc"})
+		})
+	})
+}
+
+func TestParameterTemplates_GetParameters(t *testing.T) {
+	Convey("Given parameter templates", t, func() {
+		templates, err := NewParameterTemplates(
+			"/datasets/{dataset_id}",
+			"/datasets/{dataset_id}/editions/{edition}/versions/{version}",
+			"/datasets/{dataset_id}/editions/latest/versions/{version}",
+			"/{resource}/{id}/editions/{edition}/versions/{version}",
+		)
+		So(err, ShouldBeNil)
+
+		ctx := context.WithValue(context.Background(), common.CallerIdentityKey, "harold")
+
+		Convey("Then params are taken from the template that matches the path", func() {
+			auditParams := templates.GetParameters(ctx, "/datasets/cpih01/editions/time%20series/versions/3/", map[string]string{"id": "ignored"})
+			So(auditParams, ShouldResemble, common.Params{
+				"caller_identity": "harold",
+				"dataset_id":      "cpih01",
+				"edition":         "time series",
+				"version":         "3",
+			})
+		})
+
+		Convey("Then the template with the most fixed segments is preferred", func() {
+			auditParams := templates.GetParameters(ctx, "/datasets/cpih01/editions/latest/versions/3", nil)
+			So(auditParams, ShouldResemble, common.Params{"caller_identity": "harold", "dataset_id": "cpih01", "version": "3"})
+		})
+
+		Convey("Then paths that no template matches are handled as before", func() {
+			auditParams := templates.GetParameters(ctx, "/jobs/123", map[string]string{"id": "123"})
+			So(auditParams, ShouldResemble, common.Params{"caller_identity": "harold", "job_id": "123"})
+		})
+
+		Convey("Then an auditor only uses the templates it has been given", func() {
+			path := "/datasets/cpih01/editions/time-series/versions/3"
+			vars := map[string]string{"id": "cpih01", "edition": "time-series", "version": "3"}
+			expected := common.Params{"caller_identity": "harold", "dataset_id": "cpih01", "edition": "time-series", "version": "3"}
+
+			auditor := New(&OutboundProducerMock{}, service)
+			auditor.SetParameterTemplates(templates)
+			So(GetAuditorParameters(ctx, auditor, path, nil), ShouldResemble, expected)
+
+			So(GetAuditorParameters(ctx, New(&OutboundProducerMock{}, service), path, nil), ShouldResemble, common.Params{"caller_identity": "harold"})
+			So(GetAuditorParameters(ctx, &AuditorServiceMock{}, path, vars), ShouldResemble, expected)
+		})
+	})
+
+	Convey("Given templates that are not valid", t, func() {
+		for _, template := range []string{"datasets/{id}", "/datasets//{id}", "/datasets/{}", "/datasets/{id}/editions/{id}"} {
+			_, err := NewParameterTemplates(template)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"net/http"
+
+	"github.com/ONSdigital/go-ns/request"
+	"github.com/gorilla/mux"
+)
+
+// Route identifies a gorilla/mux route by its method and path template, such as "/datasets/{id}". A Route without a
+// method matches requests with any method.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// RouteActions maps routes to the audit actions their handlers perform
+type RouteActions map[Route]string
+
+// action returns the audit action for the route matched by r, if it has one
+func (actions RouteActions) action(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+
+	if action, ok := actions[Route{Method: r.Method, Path: path}]; ok {
+		return action, true
+	}
+	action, ok := actions[Route{Path: path}]
+	return action, ok
+}
+
+// Middleware returns gorilla/mux middleware that audits the requests to the routes in actions. It records that the
+// action was attempted before calling the handler, and then that it was successful if the response status is below
+// 400, or unsuccessful if it is not or the handler panics. Params are taken from the path with
+// GetAuditorParameters. If the attempt cannot be recorded the handler is not called and the request fails with a 500.
+func Middleware(auditor AuditorService, actions RouteActions) mux.MiddlewareFunc {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action, ok := actions.action(r)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			info, ok := ctx.Value(requestKey{}).(*requestInfo)
+			if !ok {
+				ctx, w = withRequest(ctx, w, r, nil)
+				info = ctx.Value(requestKey{}).(*requestInfo)
+				r = r.WithContext(ctx)
+			}
+
+			params := GetAuditorParameters(ctx, auditor, r.URL.EscapedPath(), mux.Vars(r))
+			scope, err := StartAction(ctx, auditor, action, params)
+			if err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				request.DrainBody(r)
+				return
+			}
+			defer scope.Finish(nil)
+
+			h.ServeHTTP(w, r)
+
+			status := int(info.status.Load())
+			if err := scope.EndWithStatus(status); err != nil {
+				// the response has already been written, so the failure can only be logged
+				LogActionFailure(ctx, action, statusResult(status), err, RedactedLogData(auditor, params))
+			}
+		})
+	}
+}
+
+// statusResult is the result of an action whose response has status
+func statusResult(status int) string {
+	if status >= http.StatusBadRequest {
+		return Unsuccessful
+	}
+	return Successful
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/common"
+	"github.com/gorilla/mux"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMiddleware(t *testing.T) {
+	Convey("given a router audited by the middleware", t, func() {
+		auditor := &AuditorServiceMock{
+			RecordFunc: func(ctx context.Context, action string, result string, params common.Params) error {
+				return nil
+			},
+		}
+		status := http.StatusOK
+		called := false
+
+		router := mux.NewRouter()
+		router.HandleFunc("/datasets/{id}", func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(status)
+		}).Methods(http.MethodPut, http.MethodGet)
+		router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+		router.Use(Middleware(auditor, RouteActions{
+			{Method: http.MethodPut, Path: "/datasets/{id}"}: "put_dataset",
+		}))
+
+		serve := func(method, path string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, path, nil).WithContext(setUpContext()))
+			return w
+		}
+
+		Convey("then a successful request is recorded as attempted and then successful", func() {
+			serve(http.MethodPut, "/datasets/cpih01")
+
+			calls := auditor.RecordCalls()
+			So(calls, ShouldHaveLength, 2)
+			So(calls[0].Action, ShouldEqual, "put_dataset")
+			So(calls[0].Result, ShouldEqual, Attempted)
+			So(calls[0].Params, ShouldResemble, common.Params{"caller_identity": service, "dataset_id": "cpih01"})
+			So(calls[1].Result, ShouldEqual, Successful)
+		})
+
+		Convey("then a failed request is recorded as unsuccessful", func() {
+			status = http.StatusNotFound
+			serve(http.MethodPut, "/datasets/cpih01")
+
+			calls := auditor.RecordCalls()
+			So(calls, ShouldHaveLength, 2)
+			So(calls[1].Result, ShouldEqual, Unsuccessful)
+		})
+
+		Convey("then a handler that panics is recorded as unsuccessful", func() {
+			router.HandleFunc("/datasets/{id}/editions", func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			})
+			router.Use(Middleware(auditor, RouteActions{{Path: "/datasets/{id}/editions"}: "put_edition"}))
+
+			So(func() { serve(http.MethodPut, "/datasets/cpih01/editions") }, ShouldPanicWith, "boom")
+			calls := auditor.RecordCalls()
+			So(calls, ShouldHaveLength, 2)
+			So(calls[1].Action, ShouldEqual, "put_edition")
+			So(calls[1].Result, ShouldEqual, Unsuccessful)
+		})
+
+		Convey("then routes that are not in the table are not audited", func() {
+			serve(http.MethodGet, "/datasets/cpih01")
+			serve(http.MethodGet, "/health")
+			So(auditor.RecordCalls(), ShouldBeEmpty)
+			So(called, ShouldBeTrue)
+		})
+
+		Convey("then the handler is not called if the attempt cannot be recorded", func() {
+			auditor.RecordFunc = func(ctx context.Context, action string, result string, params common.Params) error {
+				return errors.New("auditing failed")
+			}
+
+			w := serve(http.MethodPut, "/datasets/cpih01")
+			So(w.Code, ShouldEqual, http.StatusInternalServerError)
+			So(called, ShouldBeFalse)
+			So(auditor.RecordCalls(), ShouldHaveLength, 1)
+		})
+	})
+}
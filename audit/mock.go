@@ -121,3 +121,61 @@ func (mock *OutboundProducerMock) OutputCalls() []struct {
 	lockOutboundProducerMockOutput.RUnlock()
 	return calls
 }
+
+var (
+	lockConfirmingProducerMockSend sync.RWMutex
+)
+
+// ConfirmingProducerMock is a mock implementation of ConfirmingProducer.
+type ConfirmingProducerMock struct {
+	OutboundProducerMock
+
+	// SendFunc mocks the Send method.
+	SendFunc func(ctx context.Context, message []byte) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Send holds details about calls to the Send method.
+		Send []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Message is the message argument value.
+			Message []byte
+		}
+	}
+}
+
+// Send calls SendFunc.
+func (mock *ConfirmingProducerMock) Send(ctx context.Context, message []byte) error {
+	if mock.SendFunc == nil {
+		panic("moq: ConfirmingProducerMock.SendFunc is nil but ConfirmingProducer.Send was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		Message []byte
+	}{
+		Ctx:     ctx,
+		Message: message,
+	}
+	lockConfirmingProducerMockSend.Lock()
+	mock.calls.Send = append(mock.calls.Send, callInfo)
+	lockConfirmingProducerMockSend.Unlock()
+	return mock.SendFunc(ctx, message)
+}
+
+// SendCalls gets all the calls that were made to Send.
+// Check the length with:
+//     len(mockedConfirmingProducer.SendCalls())
+func (mock *ConfirmingProducerMock) SendCalls() []struct {
+	Ctx     context.Context
+	Message []byte
+} {
+	var calls []struct {
+		Ctx     context.Context
+		Message []byte
+	}
+	lockConfirmingProducerMockSend.RLock()
+	calls = mock.calls.Send
+	lockConfirmingProducerMockSend.RUnlock()
+	return calls
+}
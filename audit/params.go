@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/go-ns/common"
+)
+
+// ParameterSource is implemented by auditors that extract audit params from request paths in their own way
+type ParameterSource interface {
+	GetParameters(ctx context.Context, path string, vars map[string]string) common.Params
+}
+
+// ParameterTemplates extracts audit params from request paths by matching them against route templates, such as
+// "/datasets/{dataset_id}/editions/{edition}", in which each segment in braces names the param that the matching
+// segment of the path is added as. When more than one template matches a path, the one with the most fixed segments
+// is used, or the first registered if they have as many.
+type ParameterTemplates struct {
+	templates []parameterTemplate
+}
+
+type parameterTemplate struct {
+	segments []string
+	fixed    int
+}
+
+// NewParameterTemplates returns ParameterTemplates for templates, or an error if any of them are not valid
+func NewParameterTemplates(templates ...string) (*ParameterTemplates, error) {
+	p := &ParameterTemplates{}
+	for _, template := range templates {
+		if err := p.Register(template); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Register adds template to the templates, returning an error if it is not valid
+func (p *ParameterTemplates) Register(template string) error {
+	if !strings.HasPrefix(template, "/") {
+		return fmt.Errorf("audit parameter template %q must start with /", template)
+	}
+
+	t := parameterTemplate{segments: splitPath(template)}
+	names := make(map[string]bool)
+	for _, segment := range t.segments {
+		name, isParam := paramName(segment)
+		switch {
+		case segment == "":
+			return fmt.Errorf("audit parameter template %q has an empty segment", template)
+		case !isParam:
+			t.fixed++
+		case name == "":
+			return fmt.Errorf("audit parameter template %q has a param without a name", template)
+		case names[name]:
+			return fmt.Errorf("audit parameter template %q has more than one %s param", template, name)
+		default:
+			names[name] = true
+		}
+	}
+
+	p.templates = append(p.templates, t)
+	return nil
+}
+
+// Params returns the params of path from the template that best matches it, and whether any template matched
+func (p *ParameterTemplates) Params(path string) (common.Params, bool) {
+	segments := splitPath(path)
+
+	var best *parameterTemplate
+	for i := range p.templates {
+		t := &p.templates[i]
+		if t.matches(segments) && (best == nil || t.fixed > best.fixed) {
+			best = t
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+
+	params := common.Params{}
+	for i, segment := range best.segments {
+		if name, isParam := paramName(segment); isParam {
+			value, err := url.PathUnescape(segments[i])
+			if err != nil {
+				value = segments[i]
+			}
+			params[name] = value
+		}
+	}
+	return params, true
+}
+
+func (t *parameterTemplate) matches(segments []string) bool {
+	if len(segments) != len(t.segments) {
+		return false
+	}
+	for i, segment := range t.segments {
+		if _, isParam := paramName(segment); !isParam && segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetParameters returns the params of path from the template that matches it, with the caller identity in ctx.
+// Paths that none of the templates match, or all paths if p is nil, are handled by the GetParameters function.
+func (p *ParameterTemplates) GetParameters(ctx context.Context, path string, vars map[string]string) common.Params {
+	if p == nil {
+		return GetParameters(ctx, path, vars)
+	}
+	params, ok := p.Params(path)
+	if !ok {
+		return GetParameters(ctx, path, vars)
+	}
+
+	if callerIdentity := common.Caller(ctx); callerIdentity != "" {
+		params["caller_identity"] = callerIdentity
+	}
+	return params
+}
+
+// SetParameterTemplates sets the templates that the auditor's GetParameters extracts params with. It must be called
+// before the auditor is used.
+func (a *Auditor) SetParameterTemplates(templates *ParameterTemplates) {
+	a.templates = templates
+}
+
+// GetParameters returns the params of path using the auditor's templates
+func (a *Auditor) GetParameters(ctx context.Context, path string, vars map[string]string) common.Params {
+	return a.templates.GetParameters(ctx, path, vars)
+}
+
+// GetAuditorParameters returns the params of path for auditor, using its own templates if it is a ParameterSource
+// and the GetParameters function if it is not
+func GetAuditorParameters(ctx context.Context, auditor AuditorService, path string, vars map[string]string) common.Params {
+	if s, ok := auditor.(ParameterSource); ok {
+		return s.GetParameters(ctx, path, vars)
+	}
+	return GetParameters(ctx, path, vars)
+}
+
+// splitPath returns the segments of path, ignoring any leading or trailing slash
+func splitPath(path string) []string {
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// paramName returns the name of segment if it is a param
+func paramName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
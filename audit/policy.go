@@ -0,0 +1,59 @@
+package audit
+
+// Actors sets whose actions are audited
+type Actors int
+
+// Actors whose actions can be audited. An action is taken by a user if there is a user identity in the request
+// context, otherwise by the service whose caller identity is in the context.
+const (
+	// UsersOnly audits actions taken by users, skipping those taken by services
+	UsersOnly Actors = iota
+	// ServicesOnly audits actions taken by services, skipping those taken by users
+	ServicesOnly
+	// UsersAndServices audits every action
+	UsersAndServices
+)
+
+func (a Actors) audits(isUser bool) bool {
+	switch a {
+	case UsersAndServices:
+		return true
+	case ServicesOnly:
+		return !isUser
+	default:
+		return isUser
+	}
+}
+
+func (a Actors) String() string {
+	switch a {
+	case ServicesOnly:
+		return "services only"
+	case UsersAndServices:
+		return "users and services"
+	default:
+		return "users only"
+	}
+}
+
+// Policy sets which actions an Auditor records. The zero Policy only records actions taken by users.
+type Policy struct {
+	// Actors are whose actions are recorded, unless the action is in Actions
+	Actors Actors
+	// Actions sets whose actions are recorded for particular actions, overriding Actors
+	Actions map[string]Actors
+}
+
+// actors returns whose actions are recorded for action
+func (p Policy) actors(action string) Actors {
+	if actors, ok := p.Actions[action]; ok {
+		return actors
+	}
+	return p.Actors
+}
+
+// SetPolicy sets which actions the auditor records. Events for actions taken by services have the caller identity
+// of the service, which is added to their params as caller_identity so that it is included in v1 events.
+func (a *Auditor) SetPolicy(policy Policy) {
+	a.policy = policy
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuditor_SetPolicy(t *testing.T) {
+	Convey("given an auditor", t, func() {
+		var written []Event
+		auditor := NewWithSink(sinkFunc(func(ctx context.Context, e Event) error {
+			written = append(written, e)
+			return nil
+		}), service)
+
+		userCtx := setUpContext()
+		serviceCtx := common.SetCaller(context.Background(), "dp-import-tracker")
+
+		Convey("then by default only actions taken by users are recorded", func() {
+			So(auditor.Record(userCtx, auditAction, Successful, nil), ShouldBeNil)
+			So(auditor.Record(serviceCtx, auditAction, Successful, nil), ShouldBeNil)
+			So(written, ShouldHaveLength, 1)
+			So(written[0].User, ShouldEqual, user)
+		})
+
+		Convey("when it only audits services", func() {
+			auditor.SetPolicy(Policy{Actors: ServicesOnly})
+
+			Convey("then only actions taken by services are recorded, with the caller identity", func() {
+				So(auditor.Record(userCtx, auditAction, Successful, nil), ShouldBeNil)
+				So(auditor.Record(serviceCtx, auditAction, Successful, common.Params{"ID": "12345"}), ShouldBeNil)
+				So(written, ShouldHaveLength, 1)
+				So(written[0].User, ShouldBeEmpty)
+				So(written[0].Caller, ShouldEqual, "dp-import-tracker")
+				So(written[0].Params, ShouldResemble, common.Params{"ID": "12345", "caller_identity": "dp-import-tracker"})
+			})
+		})
+
+		Convey("when it audits users and services", func() {
+			auditor.SetPolicy(Policy{Actors: UsersAndServices})
+
+			Convey("then every action is recorded", func() {
+				So(auditor.Record(userCtx, auditAction, Successful, nil), ShouldBeNil)
+				So(auditor.Record(serviceCtx, auditAction, Successful, nil), ShouldBeNil)
+				So(written, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("when it has rules for particular actions", func() {
+			auditor.SetPolicy(Policy{Actions: map[string]Actors{"publish": UsersAndServices}})
+
+			Convey("then those actions are recorded as the rule says", func() {
+				So(auditor.Record(serviceCtx, "publish", Successful, nil), ShouldBeNil)
+				So(auditor.Record(serviceCtx, auditAction, Successful, nil), ShouldBeNil)
+				So(written, ShouldHaveLength, 1)
+				So(written[0].AttemptedAction, ShouldEqual, "publish")
+			})
+		})
+	})
+}
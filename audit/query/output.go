@@ -0,0 +1,133 @@
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/avro"
+	"github.com/ONSdigital/go-ns/common"
+)
+
+// Output formats
+const (
+	Table      = "table"
+	JSONLines  = "jsonl"
+	CSV        = "csv"
+	AvroStream = "avro"
+)
+
+// Writer writes audit events in an output format
+type Writer interface {
+	Write(e audit.Event) error
+	// Flush writes any events that have been buffered
+	Flush() error
+}
+
+// NewWriter returns a Writer for format that writes to w. The avro format writes events encoded with schema one after
+// another, so that they can be replayed to a producer or read again with a Reader.
+func NewWriter(format string, w io.Writer, schema *avro.Schema) (Writer, error) {
+	switch format {
+	case Table:
+		return newTableWriter(w), nil
+	case JSONLines:
+		return &jsonLinesWriter{enc: json.NewEncoder(w)}, nil
+	case CSV:
+		return newCSVWriter(w), nil
+	case AvroStream:
+		return &avroWriter{enc: avro.NewEncoder(w, schema)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+var columns = []string{"time", "service", "request_id", "user", "caller", "attempted_action", "action_result", "params"}
+
+// row returns the values of the columns of e
+func row(e audit.Event) []string {
+	created := e.Created
+	if t, ok := Time(e); ok {
+		created = t.UTC().Format(time.RFC3339Nano)
+	}
+	return []string{created, e.Service, e.RequestID, e.User, e.Caller, e.AttemptedAction, e.ActionResult,
+		formatParams(e.Params)}
+}
+
+// formatParams returns params as key=value pairs, in order of their keys
+func formatParams(params common.Params) string {
+	pairs := make([]string, 0, len(params))
+	for k, v := range params {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+type tableWriter struct {
+	tw *tabwriter.Writer
+}
+
+func newTableWriter(w io.Writer) *tableWriter {
+	t := &tableWriter{tw: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	fmt.Fprintln(t.tw, strings.ToUpper(strings.Join(columns, "\t")))
+	return t
+}
+
+func (t *tableWriter) Write(e audit.Event) error {
+	_, err := fmt.Fprintln(t.tw, strings.Join(row(e), "\t"))
+	return err
+}
+
+func (t *tableWriter) Flush() error {
+	return t.tw.Flush()
+}
+
+type jsonLinesWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonLinesWriter) Write(e audit.Event) error {
+	return j.enc.Encode(e)
+}
+
+func (j *jsonLinesWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	c.w.Write(columns)
+	return c
+}
+
+func (c *csvWriter) Write(e audit.Event) error {
+	return c.w.Write(row(e))
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type avroWriter struct {
+	enc *avro.Encoder
+}
+
+func (a *avroWriter) Write(e audit.Event) error {
+	return a.enc.Encode(e)
+}
+
+func (a *avroWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,135 @@
+// Package query reads captured audit events, such as those consumed from the audit topic, and finds the ones that
+// match a Filter.
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/avro"
+)
+
+// containerMagic starts every avro object container file
+var containerMagic = []byte{'O', 'b', 'j', 1}
+
+// createdLayout is the layout of the Created field of events, which is written with time.Time.String
+const createdLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// Filter selects audit events. Events match if they match every field that is set, and a field with several values
+// matches if any of them does.
+type Filter struct {
+	Users    []string
+	Services []string
+	Actions  []string
+	Results  []string
+	// Params are the values that params of the events must have
+	Params map[string]string
+	// From and To, if set, are the earliest and latest time of the events
+	From time.Time
+	To   time.Time
+}
+
+// Match reports whether e matches the filter. Events whose time cannot be read do not match a time range.
+func (f Filter) Match(e audit.Event) bool {
+	if !matchAny(f.Users, e.User) || !matchAny(f.Services, e.Service) ||
+		!matchAny(f.Actions, e.AttemptedAction) || !matchAny(f.Results, e.ActionResult) {
+		return false
+	}
+	for k, v := range f.Params {
+		if actual, ok := e.Params[k]; !ok || actual != v {
+			return false
+		}
+	}
+
+	if f.From.IsZero() && f.To.IsZero() {
+		return true
+	}
+	t, ok := Time(e)
+	if !ok {
+		return false
+	}
+	return (f.From.IsZero() || !t.Before(f.From)) && (f.To.IsZero() || !t.After(f.To))
+}
+
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Time returns when e was recorded, from its timestamp if it was encoded with audit.EventV2Schema, otherwise from the
+// time it was created
+func Time(e audit.Event) (time.Time, bool) {
+	if !e.Timestamp.IsZero() {
+		return e.Timestamp, true
+	}
+
+	// times from time.Now include a monotonic clock reading, which cannot be parsed
+	created, _, _ := strings.Cut(e.Created, " m=")
+	t, err := time.Parse(createdLayout, created)
+	return t, err == nil
+}
+
+// Reader reads audit events either from an avro object container file, or from a stream of avro encoded events
+// written one after another
+type Reader struct {
+	file   *avro.FileReader
+	stream *avro.Decoder
+}
+
+// NewReader returns a Reader for the events in r. Streams of events are decoded with schema, such as
+// audit.EventSchema, whereas container files are decoded with the schema in the file.
+func NewReader(r io.Reader, schema *avro.Schema) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(containerMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.Equal(magic, containerMagic) {
+		file, err := avro.NewFileReader(br, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{file: file}, nil
+	}
+	return &Reader{stream: avro.NewDecoder(br, schema)}, nil
+}
+
+// Read returns the next event, or io.EOF once every event has been read
+func (r *Reader) Read() (audit.Event, error) {
+	var e audit.Event
+	if r.file != nil {
+		return e, r.file.Read(&e)
+	}
+	return e, r.stream.Decode(&e)
+}
+
+// Find calls fn with each event read from r that matches filter, stopping if fn returns an error
+func Find(r *Reader, filter Filter, fn func(audit.Event) error) error {
+	for {
+		e, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filter.Match(e) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
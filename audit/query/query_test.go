@@ -0,0 +1,135 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/go-ns/audit"
+	"github.com/ONSdigital/go-ns/avro"
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	monday  = time.Date(2024, 5, 6, 9, 30, 0, 0, time.UTC)
+	tuesday = monday.Add(24 * time.Hour)
+
+	events = []audit.Event{
+		{Created: monday.String(), Service: "dp-dataset-api", User: "alice", AttemptedAction: "put_dataset",
+			ActionResult: audit.Successful, Params: common.Params{"dataset_id": "cpih01"}},
+		{Created: tuesday.Add(time.Millisecond).Local().String(), Service: "dp-dataset-api", User: "bob",
+			AttemptedAction: "put_dataset", ActionResult: audit.Unsuccessful, Params: common.Params{"dataset_id": "cpih01"}},
+		{Created: tuesday.String(), Service: "dp-filter-api", User: "alice", AttemptedAction: "put_filter",
+			ActionResult: audit.Successful, Params: common.Params{"filter_id": "abc"}},
+	}
+)
+
+// stream returns events encoded one after another with the v1 schema
+func stream(events []audit.Event) *bytes.Buffer {
+	var buf bytes.Buffer
+	enc := avro.NewEncoder(&buf, audit.EventSchema)
+	for _, e := range events {
+		So(enc.Encode(e), ShouldBeNil)
+	}
+	return &buf
+}
+
+func find(buf *bytes.Buffer, filter Filter) []string {
+	r, err := NewReader(buf, audit.EventSchema)
+	So(err, ShouldBeNil)
+
+	var users []string
+	So(Find(r, filter, func(e audit.Event) error {
+		users = append(users, e.User+" "+e.AttemptedAction)
+		return nil
+	}), ShouldBeNil)
+	return users
+}
+
+func TestFind(t *testing.T) {
+	Convey("given a stream of avro encoded events", t, func() {
+		buf := stream(events)
+
+		Convey("then every event matches an empty filter", func() {
+			So(find(buf, Filter{}), ShouldHaveLength, 3)
+		})
+
+		Convey("then events can be filtered by user, service, action and result", func() {
+			So(find(buf, Filter{Users: []string{"alice"}, Services: []string{"dp-dataset-api"}}), ShouldResemble,
+				[]string{"alice put_dataset"})
+		})
+
+		Convey("then events can be filtered by param", func() {
+			So(find(buf, Filter{Params: map[string]string{"dataset_id": "cpih01"}, Results: []string{audit.Unsuccessful}}),
+				ShouldResemble, []string{"bob put_dataset"})
+		})
+
+		Convey("then events can be filtered by time", func() {
+			So(find(buf, Filter{From: tuesday}), ShouldResemble, []string{"bob put_dataset", "alice put_filter"})
+			So(find(stream(events), Filter{To: tuesday}), ShouldResemble, []string{"alice put_dataset", "alice put_filter"})
+		})
+	})
+
+	Convey("given an avro container file of v2 events", t, func() {
+		var buf bytes.Buffer
+		fw, err := avro.NewFileWriter(&buf, audit.EventV2Schema, avro.CodecDeflate)
+		So(err, ShouldBeNil)
+		So(fw.Write(audit.Event{User: "carol", AttemptedAction: "delete_dataset", Timestamp: tuesday}), ShouldBeNil)
+		So(fw.Close(), ShouldBeNil)
+
+		Convey("then the events are read from the file and times taken from their timestamps", func() {
+			So(find(&buf, Filter{From: monday}), ShouldResemble, []string{"carol delete_dataset"})
+		})
+	})
+}
+
+func TestWriter(t *testing.T) {
+	Convey("given events written in each format", t, func() {
+		write := func(format string) string {
+			var out bytes.Buffer
+			w, err := NewWriter(format, &out, audit.EventSchema)
+			So(err, ShouldBeNil)
+			for _, e := range events[:2] {
+				So(w.Write(e), ShouldBeNil)
+			}
+			So(w.Flush(), ShouldBeNil)
+			return out.String()
+		}
+
+		Convey("then a table has a row for each event", func() {
+			lines := strings.Split(strings.TrimSpace(write(Table)), "\n")
+			So(lines, ShouldHaveLength, 3)
+			So(lines[0], ShouldStartWith, "TIME")
+			So(lines[1], ShouldStartWith, "2024-05-06T09:30:00Z")
+			So(lines[1], ShouldContainSubstring, `dataset_id="cpih01"`)
+		})
+
+		Convey("then JSON lines has an event on each line", func() {
+			lines := strings.Split(strings.TrimSpace(write(JSONLines)), "\n")
+			So(lines, ShouldHaveLength, 2)
+			var e audit.Event
+			So(json.Unmarshal([]byte(lines[1]), &e), ShouldBeNil)
+			So(e.User, ShouldEqual, "bob")
+		})
+
+		Convey("then CSV has a header and a record for each event", func() {
+			lines := strings.Split(strings.TrimSpace(write(CSV)), "\n")
+			So(lines, ShouldHaveLength, 3)
+			So(lines[0], ShouldEqual, strings.Join(columns, ","))
+			So(lines[2], ShouldContainSubstring, "2024-05-07T09:30:00.001Z")
+		})
+
+		Convey("then avro can be read again", func() {
+			So(find(bytes.NewBufferString(write(AvroStream)), Filter{}), ShouldResemble,
+				[]string{"alice put_dataset", "bob put_dataset"})
+		})
+
+		Convey("then an unknown format is an error", func() {
+			_, err := NewWriter("xml", &bytes.Buffer{}, audit.EventSchema)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
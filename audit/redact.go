@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/ONSdigital/go-ns/common"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Redacted replaces the param values, and parts of values, that a RedactionPolicy keeps out of audit events and logs
+const Redacted = "[REDACTED]"
+
+// RedactionPolicy sets which audit params are kept out of audit events, audit errors and log data, so that tokens or
+// personal data passed in params are never sent or logged. Keys are matched regardless of case. A key that is both
+// denied and hashed is denied, and a hashed key does not need to be allowed.
+type RedactionPolicy struct {
+	// Allow, if set, lists the only keys whose values are kept. The values of any other keys are redacted.
+	Allow []string
+	// Deny lists keys whose values are always redacted
+	Deny []string
+	// Mask lists patterns that are redacted wherever they appear in the values that are kept
+	Mask []*regexp.Regexp
+	// Hash lists keys whose values are replaced with a hex encoded SHA-256 hash, so that identifiers can still be
+	// matched up across events without being revealed
+	Hash []string
+	// HashKey, if set, keys the hash with HMAC, so that hashed values cannot be found by hashing guesses
+	HashKey []byte
+}
+
+// Redactor is implemented by auditors that redact the params of the events they record
+type Redactor interface {
+	Redact(params common.Params) common.Params
+}
+
+// SetRedactionPolicy sets the policy the auditor applies to the params of every event it records and of the errors
+// it returns. A nil policy, the default, keeps params as they are. It must be called before the auditor is used.
+func (a *Auditor) SetRedactionPolicy(policy *RedactionPolicy) {
+	a.redaction = policy
+}
+
+// Redact returns params redacted by the auditor's redaction policy
+func (a *Auditor) Redact(params common.Params) common.Params {
+	return a.redaction.Apply(params)
+}
+
+// Apply returns a copy of params redacted as set by the policy
+func (p *RedactionPolicy) Apply(params common.Params) common.Params {
+	if p == nil || params == nil {
+		return params
+	}
+
+	redacted := make(common.Params, len(params))
+	for k, v := range params {
+		switch {
+		case containsKey(p.Deny, k):
+			redacted[k] = Redacted
+		case containsKey(p.Hash, k):
+			redacted[k] = p.hash(v)
+		case len(p.Allow) > 0 && !containsKey(p.Allow, k):
+			redacted[k] = Redacted
+		default:
+			for _, re := range p.Mask {
+				v = re.ReplaceAllLiteralString(v, Redacted)
+			}
+			redacted[k] = v
+		}
+	}
+	return redacted
+}
+
+func (p *RedactionPolicy) hash(v string) string {
+	if len(p.HashKey) == 0 {
+		sum := sha256.Sum256([]byte(v))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, p.HashKey)
+	mac.Write([]byte(v))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactedLogData converts params to log.Data like ToLogData, first redacting them if auditor is a Redactor, so that
+// params can be logged alongside a failure to record them
+func RedactedLogData(auditor AuditorService, params common.Params) log.Data {
+	if r, ok := auditor.(Redactor); ok {
+		params = r.Redact(params)
+	}
+	return ToLogData(params)
+}
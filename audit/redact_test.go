@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/common"
+	"github.com/ONSdigital/log.go/v2/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedactionPolicy_Apply(t *testing.T) {
+	params := common.Params{
+		"dataset_id": "cpih01",
+		"token":      "abc123",
+		"email":      "someone@example.com",
+		"query":      "contact someone@example.com",
+	}
+	email := regexp.MustCompile(`[^@\s]+@[^@\s]+`)
+
+	Convey("a nil policy keeps params as they are", t, func() {
+		var policy *RedactionPolicy
+		So(policy.Apply(params), ShouldResemble, params)
+	})
+
+	Convey("denied keys are redacted regardless of case", t, func() {
+		policy := &RedactionPolicy{Deny: []string{"TOKEN"}}
+		redacted := policy.Apply(params)
+		So(redacted["token"], ShouldEqual, Redacted)
+		So(redacted["dataset_id"], ShouldEqual, "cpih01")
+		So(params["token"], ShouldEqual, "abc123")
+	})
+
+	Convey("only allowed and hashed keys are kept when there is an allow list", t, func() {
+		policy := &RedactionPolicy{Allow: []string{"dataset_id"}, Hash: []string{"email"}}
+		redacted := policy.Apply(params)
+		So(redacted["dataset_id"], ShouldEqual, "cpih01")
+		So(redacted["token"], ShouldEqual, Redacted)
+		So(redacted["query"], ShouldEqual, Redacted)
+		So(redacted["email"], ShouldHaveLength, 64)
+	})
+
+	Convey("matching values are masked", t, func() {
+		policy := &RedactionPolicy{Mask: []*regexp.Regexp{email}}
+		So(policy.Apply(params)["query"], ShouldEqual, "contact "+Redacted)
+	})
+
+	Convey("hashed values can be matched up but not read", t, func() {
+		policy := &RedactionPolicy{Hash: []string{"email"}}
+		hashed := policy.Apply(params)["email"]
+		So(hashed, ShouldNotEqual, params["email"])
+		So(policy.Apply(common.Params{"email": "someone@example.com"})["email"], ShouldEqual, hashed)
+
+		keyed := &RedactionPolicy{Hash: []string{"email"}, HashKey: []byte("key")}
+		So(keyed.Apply(params)["email"], ShouldNotEqual, hashed)
+	})
+
+	Convey("denied keys are not hashed", t, func() {
+		policy := &RedactionPolicy{Deny: []string{"email"}, Hash: []string{"email"}}
+		So(policy.Apply(params)["email"], ShouldEqual, Redacted)
+	})
+}
+
+func TestAuditor_SetRedactionPolicy(t *testing.T) {
+	Convey("given an auditor with a redaction policy", t, func() {
+		var written Event
+		fail := false
+		auditor := NewWithSink(sinkFunc(func(ctx context.Context, e Event) error {
+			if fail {
+				return errors.New("disk full")
+			}
+			written = e
+			return nil
+		}), service)
+		auditor.SetRedactionPolicy(&RedactionPolicy{Deny: []string{"token"}})
+		params := common.Params{"ID": "12345", "token": "abc123"}
+
+		Convey("then recorded events are redacted", func() {
+			So(auditor.Record(setUpContext(), auditAction, Successful, params), ShouldBeNil)
+			So(written.Params, ShouldResemble, common.Params{"ID": "12345", "token": Redacted})
+			So(params["token"], ShouldEqual, "abc123")
+		})
+
+		Convey("then the errors it returns are redacted", func() {
+			fail = true
+			err := auditor.Record(setUpContext(), auditAction, Successful, params)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unable to audit event, attempted action: test, action result: successful, cause: error writing event to sink: disk full, params: [ID:12345, token:[REDACTED]]")
+		})
+
+		Convey("then log data for it is redacted", func() {
+			So(RedactedLogData(auditor, params), ShouldResemble, log.Data{"ID": "12345", "token": Redacted})
+		})
+
+		Convey("then other auditors are not affected", func() {
+			other := &AuditorServiceMock{}
+			So(RedactedLogData(other, params), ShouldResemble, log.Data{"ID": "12345", "token": "abc123"})
+			So(NewAuditError("cause", auditAction, Successful, params).Params, ShouldResemble, params)
+		})
+	})
+}
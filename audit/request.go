@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type requestKey struct{}
+
+// requestInfo holds the details of the HTTP request being handled that are added to its audit events
+type requestInfo struct {
+	method   string
+	path     string
+	clientIP string
+	start    time.Time
+	status   atomic.Int32
+}
+
+// statusWriter records the status of the response written for a request
+type statusWriter struct {
+	http.ResponseWriter
+	info *requestInfo
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.info.status.CompareAndSwap(0, int32(status))
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.info.status.CompareAndSwap(0, http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, so that http.ResponseController can reach it
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// RequestHandler is middleware that adds the method, path and client IP of each request, when it started and the
+// status of its response to the request context, so that they are included in the events recorded while handling it.
+// The client IP is the address the request came from. Services behind proxies should use ProxyRequestHandler.
+func RequestHandler(h http.Handler) http.Handler {
+	return ProxyRequestHandler()(h)
+}
+
+// ProxyRequestHandler returns middleware like RequestHandler for services behind the proxies in trusted. The client IP
+// of a request that came from a trusted proxy is the last address in its X-Forwarded-For header that is not a trusted
+// proxy, as the addresses before it could have been set by the client.
+func ProxyRequestHandler(trusted ...netip.Prefix) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Value(requestKey{}).(*requestInfo); ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			ctx, w := withRequest(r.Context(), w, r, trusted)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// withRequest returns a context holding the details of r, and a ResponseWriter that records the status of the
+// response in it
+func withRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, trusted []netip.Prefix) (context.Context, http.ResponseWriter) {
+	info := &requestInfo{
+		method:   r.Method,
+		path:     r.URL.Path,
+		clientIP: clientIP(r, trusted),
+		start:    time.Now(),
+	}
+	return context.WithValue(ctx, requestKey{}, info), &statusWriter{ResponseWriter: w, info: info}
+}
+
+// clientIP returns the address of the client that made r. The X-Forwarded-For header is only read if r came from a
+// trusted proxy, from the right, so that the address returned was added by a trusted proxy.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		ip = addr
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// isTrusted reports whether ip is in any of the trusted prefixes
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// addRequestInfo adds the details of the request held in ctx, if there are any, to e
+func addRequestInfo(ctx context.Context, e *Event, now time.Time) {
+	info, ok := ctx.Value(requestKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	e.Method = info.method
+	e.Path = info.path
+	e.ClientIP = info.clientIP
+	e.StatusCode = int(info.status.Load())
+	e.LatencyMillis = now.Sub(info.start).Milliseconds()
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRequestHandler(t *testing.T) {
+	Convey("given an auditor recording events while handling a request", t, func() {
+		var written []Event
+		auditor := NewWithSink(sinkFunc(func(ctx context.Context, e Event) error {
+			written = append(written, e)
+			return nil
+		}), service)
+
+		handler := RequestHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			So(auditor.Record(r.Context(), auditAction, Attempted, nil), ShouldBeNil)
+			w.WriteHeader(http.StatusCreated)
+			So(auditor.Record(r.Context(), auditAction, Successful, nil), ShouldBeNil)
+		}))
+
+		r := httptest.NewRequest(http.MethodPost, "/datasets/cpih01?q=1", nil)
+		r.RemoteAddr = "10.0.0.1:53412"
+		r = r.WithContext(common.SetCaller(setUpContext(), "dp-publishing-dataset-controller"))
+
+		Convey("then the events include the details of the request", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			So(written, ShouldHaveLength, 2)
+			for _, e := range written {
+				So(e.Method, ShouldEqual, http.MethodPost)
+				So(e.Path, ShouldEqual, "/datasets/cpih01")
+				So(e.ClientIP, ShouldEqual, "10.0.0.1")
+				So(e.Caller, ShouldEqual, "dp-publishing-dataset-controller")
+				So(e.LatencyMillis, ShouldBeGreaterThanOrEqualTo, 0)
+				So(time.Since(e.Timestamp), ShouldBeLessThan, time.Minute)
+			}
+			So(written[0].StatusCode, ShouldEqual, 0)
+			So(written[1].StatusCode, ShouldEqual, http.StatusCreated)
+		})
+
+		Convey("then a forwarded address set by the client is ignored", func() {
+			r.Header.Set("X-Forwarded-For", "192.168.1.20")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			So(written[0].ClientIP, ShouldEqual, "10.0.0.1")
+		})
+	})
+
+	Convey("given an auditor recording events for requests forwarded by trusted proxies", t, func() {
+		var written []Event
+		auditor := NewWithSink(sinkFunc(func(ctx context.Context, e Event) error {
+			written = append(written, e)
+			return nil
+		}), service)
+
+		handler := ProxyRequestHandler(netip.MustParsePrefix("10.0.0.0/24"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			So(auditor.Record(r.Context(), auditAction, Attempted, nil), ShouldBeNil)
+		}))
+
+		clientIP := func(remoteAddr string, forwarded ...string) string {
+			written = nil
+			r := httptest.NewRequest(http.MethodGet, "/datasets", nil)
+			r.RemoteAddr = remoteAddr
+			for _, f := range forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(setUpContext()))
+			So(written, ShouldHaveLength, 1)
+			return written[0].ClientIP
+		}
+
+		Convey("then the client IP is the last forwarded address that is not a trusted proxy", func() {
+			So(clientIP("10.0.0.1:53412", "192.168.1.20, 10.0.0.2"), ShouldEqual, "192.168.1.20")
+			So(clientIP("10.0.0.1:53412", "1.2.3.4, 192.168.1.20", "10.0.0.2"), ShouldEqual, "192.168.1.20")
+		})
+
+		Convey("then the header is ignored for requests that did not come from a trusted proxy", func() {
+			So(clientIP("192.168.1.30:53412", "1.2.3.4"), ShouldEqual, "192.168.1.30")
+		})
+
+		Convey("then the address of the proxy is used if nothing was forwarded", func() {
+			So(clientIP("10.0.0.1:53412"), ShouldEqual, "10.0.0.1")
+		})
+	})
+}
+
+func TestAuditor_UseSchema(t *testing.T) {
+	Convey("given an auditor using the v2 event schema", t, func() {
+		output := make(chan []byte, 1)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+		auditor := New(producer, service)
+		auditor.UseSchema(EventV2Schema)
+
+		Convey("then events are encoded with the v2 schema", func() {
+			So(auditor.Record(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+
+			var e Event
+			So(EventV2Schema.Unmarshal(<-output, &e), ShouldBeNil)
+			So(e.User, ShouldEqual, user)
+			So(e.Caller, ShouldEqual, service)
+			So(time.Since(e.Timestamp), ShouldBeLessThan, time.Minute)
+		})
+	})
+}
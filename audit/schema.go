@@ -51,7 +51,148 @@ var event = `{
   ]
 }`
 
+var eventV2 = `{
+  "type": "record",
+  "name": "audit-event-v2",
+  "namespace": "",
+  "fields": [
+    {
+      "type": "string",
+      "name": "created",
+      "default": ""
+    },
+    {
+      "name": "service",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "request_id",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "user",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "attempted_action",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "action_result",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "params",
+      "default": null,
+      "type": [
+        "null",
+        {
+          "type": "map",
+          "values": "string"
+        }
+      ]
+    },
+    {
+      "name": "chain_id",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "sequence",
+      "type": "long",
+      "default": 0
+    },
+    {
+      "name": "previous_digest",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "signature",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "timestamp",
+      "type": {
+        "type": "long",
+        "logicalType": "timestamp-millis"
+      },
+      "default": 0
+    },
+    {
+      "name": "caller",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "method",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "path",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "status_code",
+      "type": "int",
+      "default": 0
+    },
+    {
+      "name": "client_ip",
+      "type": "string",
+      "default": ""
+    },
+    {
+      "name": "latency_millis",
+      "type": "long",
+      "default": 0
+    }
+  ]
+}`
+
 // EventSchema defines the avro schema for an audit event.
 var EventSchema *avro.Schema = &avro.Schema{
 	Definition: event,
 }
+
+// EventV2Schema defines version 2 of the avro schema for an audit event, which adds a machine readable timestamp,
+// the caller service, details of the HTTP request and the links of signed events to the fields of EventSchema.
+var EventV2Schema *avro.Schema = &avro.Schema{
+	Definition: eventV2,
+}
+
+// EventBatchSchema defines the avro schema for a batch of audit events, sent by auditors with a BatchConfig.
+var EventBatchSchema *avro.Schema = &avro.Schema{
+	Definition: batchOf(event),
+}
+
+// EventBatchV2Schema defines the avro schema for a batch of audit events encoded with EventV2Schema
+var EventBatchV2Schema *avro.Schema = &avro.Schema{
+	Definition: batchOf(eventV2),
+}
+
+// batchOf returns the definition of a batch of the given event definition
+func batchOf(event string) string {
+	return `{
+  "type": "record",
+  "name": "audit-event-batch",
+  "namespace": "",
+  "fields": [
+    {
+      "name": "events",
+      "type": {
+        "type": "array",
+        "items": ` + event + `
+      }
+    }
+  ]
+}`
+}
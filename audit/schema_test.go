@@ -2,7 +2,9 @@ package audit
 
 import (
 	"testing"
+	"time"
 
+	"github.com/ONSdigital/go-ns/avro"
 	"github.com/ONSdigital/go-ns/common"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -50,3 +52,84 @@ func TestEventSchema(t *testing.T) {
 		})
 	})
 }
+
+func TestEventSchemaDrift(t *testing.T) {
+	Convey("the hand-written v2 event schema matches the Event struct", t, func() {
+		drift, err := EventV2Schema.Drift(Event{})
+		So(err, ShouldBeNil)
+		So(drift, ShouldBeEmpty)
+
+		Convey("and encodes events exactly as a schema generated from the struct", func() {
+			generated, err := avro.Generate("audit-event-v2", Event{})
+			So(err, ShouldBeNil)
+
+			auditEvent := Event{Service: testService, RequestID: reqID, Params: params, Created: created,
+				Timestamp: time.UnixMilli(1700000000123), Method: "PUT", StatusCode: 200}
+			expected, err := EventV2Schema.Marshal(auditEvent)
+			So(err, ShouldBeNil)
+
+			actual, err := generated.Marshal(auditEvent)
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+		})
+	})
+
+	Convey("the v1 event schema only leaves out the fields added in v2", t, func() {
+		drift, err := EventSchema.Drift(Event{})
+		So(err, ShouldBeNil)
+		So(drift, ShouldResemble, []string{
+			"chain_id: in audit.Event but not in the schema",
+			"sequence: in audit.Event but not in the schema",
+			"previous_digest: in audit.Event but not in the schema",
+			"signature: in audit.Event but not in the schema",
+			"timestamp: in audit.Event but not in the schema",
+			"caller: in audit.Event but not in the schema",
+			"method: in audit.Event but not in the schema",
+			"path: in audit.Event but not in the schema",
+			"status_code: in audit.Event but not in the schema",
+			"client_ip: in audit.Event but not in the schema",
+			"latency_millis: in audit.Event but not in the schema",
+		})
+	})
+}
+
+func TestEventV2Schema(t *testing.T) {
+	Convey("given a v2 audit event", t, func() {
+		auditEvent := Event{
+			Service:         testService,
+			RequestID:       reqID,
+			Params:          params,
+			AttemptedAction: attemptedAction,
+			ActionResult:    actionResult,
+			User:            testUser,
+			Created:         created,
+			Timestamp:       time.UnixMilli(1700000000123).UTC(),
+			Caller:          "dp-import-api",
+			Method:          "PUT",
+			Path:            "/datasets/cpih01",
+			StatusCode:      200,
+			ClientIP:        "10.0.0.1",
+			LatencyMillis:   42,
+		}
+
+		Convey("then it round trips through the v2 schema", func() {
+			b, err := EventV2Schema.Marshal(auditEvent)
+			So(err, ShouldBeNil)
+
+			var actual Event
+			So(EventV2Schema.Unmarshal(b, &actual), ShouldBeNil)
+			So(actual, ShouldResemble, auditEvent)
+		})
+
+		Convey("then existing consumers can still read it with the v1 schema", func() {
+			b, err := EventSchema.Marshal(auditEvent)
+			So(err, ShouldBeNil)
+
+			var actual Event
+			So(EventSchema.Unmarshal(b, &actual), ShouldBeNil)
+			So(actual.User, ShouldEqual, testUser)
+			So(actual.Params, ShouldResemble, params)
+			So(actual.Method, ShouldBeEmpty)
+		})
+	})
+}
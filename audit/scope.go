@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ONSdigital/go-ns/common"
+)
+
+// ActionScope is an action that has been recorded as attempted, and records its outcome once, when it ends
+type ActionScope struct {
+	ctx     context.Context
+	auditor AuditorService
+	action  string
+	params  common.Params
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// StartAction records that action has been attempted and returns a scope that records its outcome, with the same
+// params and the identities in ctx. If the attempt cannot be recorded the error is returned and there is no scope:
+// the action must not go ahead. Otherwise the action is successful or unsuccessful when the scope ends:
+//
+//	scope, err := audit.StartAction(ctx, auditor, "put_dataset", params)
+//	if err != nil {
+//		return err
+//	}
+//	defer scope.Finish(&err)
+//
+// The outcome is recorded even if ctx has been cancelled, so that every attempted event has a matching outcome. The
+// auditor should have a delivery timeout so that this cannot wait forever.
+func StartAction(ctx context.Context, auditor AuditorService, action string, params common.Params) (*ActionScope, error) {
+	if err := auditor.Record(ctx, action, Attempted, params); err != nil {
+		return nil, err
+	}
+	return &ActionScope{ctx: context.WithoutCancel(ctx), auditor: auditor, action: action, params: params}, nil
+}
+
+// End records that the action was successful if err is nil, or unsuccessful otherwise. Only the first outcome is
+// recorded, so End does nothing and returns nil if the scope has already ended.
+func (s *ActionScope) End(err error) error {
+	if err != nil {
+		return s.end(Unsuccessful)
+	}
+	return s.end(Successful)
+}
+
+// EndWithStatus records that the action was successful if the HTTP response status is below 400, or unsuccessful
+// otherwise
+func (s *ActionScope) EndWithStatus(status int) error {
+	return s.end(statusResult(status))
+}
+
+// Finish ends the scope with the error errp points to, and is deferred by the function performing the action. If
+// that function panics the action is recorded as unsuccessful before the panic carries on. A failure to record the
+// outcome is returned through errp if there is no other error, and is otherwise logged.
+func (s *ActionScope) Finish(errp *error) {
+	if p := recover(); p != nil {
+		if err := s.end(Unsuccessful); err != nil {
+			LogActionFailure(s.ctx, s.action, Unsuccessful, err, RedactedLogData(s.auditor, s.params))
+		}
+		panic(p)
+	}
+
+	var err error
+	if errp != nil {
+		err = *errp
+	}
+	result := Successful
+	if err != nil {
+		result = Unsuccessful
+	}
+
+	if auditErr := s.end(result); auditErr != nil {
+		if errp != nil && *errp == nil {
+			*errp = auditErr
+			return
+		}
+		LogActionFailure(s.ctx, s.action, result, auditErr, RedactedLogData(s.auditor, s.params))
+	}
+}
+
+func (s *ActionScope) end(result string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return nil
+	}
+	s.ended = true
+
+	return s.auditor.Record(s.ctx, s.action, result, s.params)
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestActionScope(t *testing.T) {
+	Convey("given an action scope", t, func() {
+		auditor := &AuditorServiceMock{
+			RecordFunc: func(ctx context.Context, action string, result string, params common.Params) error {
+				return nil
+			},
+		}
+		ctx, cancel := context.WithCancel(setUpContext())
+		defer cancel()
+		params := common.Params{"dataset_id": "cpih01"}
+
+		results := func() []string {
+			var results []string
+			for _, c := range auditor.RecordCalls() {
+				So(c.Action, ShouldEqual, "put_dataset")
+				So(c.Params, ShouldResemble, params)
+				results = append(results, c.Result)
+			}
+			return results
+		}
+
+		scope, err := StartAction(ctx, auditor, "put_dataset", params)
+		So(err, ShouldBeNil)
+
+		Convey("then the attempt is recorded straight away", func() {
+			So(results(), ShouldResemble, []string{Attempted})
+		})
+
+		Convey("then the outcome is recorded from an error", func() {
+			So(scope.End(errors.New("not found")), ShouldBeNil)
+			So(results(), ShouldResemble, []string{Attempted, Unsuccessful})
+		})
+
+		Convey("then the outcome is recorded from a status code", func() {
+			So(scope.EndWithStatus(http.StatusCreated), ShouldBeNil)
+			So(results(), ShouldResemble, []string{Attempted, Successful})
+		})
+
+		Convey("then only the first outcome is recorded", func() {
+			So(scope.End(nil), ShouldBeNil)
+			So(scope.EndWithStatus(http.StatusInternalServerError), ShouldBeNil)
+			scope.Finish(nil)
+			So(results(), ShouldResemble, []string{Attempted, Successful})
+		})
+
+		Convey("then the outcome is recorded after the request context is cancelled", func() {
+			cancel()
+			So(scope.End(nil), ShouldBeNil)
+			So(auditor.RecordCalls()[1].Ctx.Err(), ShouldBeNil)
+			So(common.User(auditor.RecordCalls()[1].Ctx), ShouldEqual, user)
+		})
+
+		Convey("then a deferred Finish records the error returned", func() {
+			action := func(fail error) (err error) {
+				scope, err := StartAction(ctx, auditor, "put_dataset", params)
+				if err != nil {
+					return err
+				}
+				defer scope.Finish(&err)
+				return fail
+			}
+
+			So(action(nil), ShouldBeNil)
+			So(action(errors.New("not found")), ShouldNotBeNil)
+			So(results(), ShouldResemble, []string{Attempted, Attempted, Successful, Attempted, Unsuccessful})
+		})
+
+		Convey("then a deferred Finish records a panic as unsuccessful and carries on panicking", func() {
+			action := func() (err error) {
+				defer scope.Finish(&err)
+				panic("boom")
+			}
+
+			So(func() { action() }, ShouldPanicWith, "boom")
+			So(results(), ShouldResemble, []string{Attempted, Unsuccessful})
+		})
+
+		Convey("then a failure to record a successful outcome is returned by Finish", func() {
+			auditor.RecordFunc = func(ctx context.Context, action string, result string, params common.Params) error {
+				return errors.New("auditing failed")
+			}
+
+			var err error
+			scope.Finish(&err)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("given an attempt that cannot be recorded", t, func() {
+		auditor := &AuditorServiceMock{
+			RecordFunc: func(ctx context.Context, action string, result string, params common.Params) error {
+				return errors.New("auditing failed")
+			},
+		}
+
+		Convey("then there is no scope", func() {
+			scope, err := StartAction(setUpContext(), auditor, "put_dataset", nil)
+			So(err, ShouldNotBeNil)
+			So(scope, ShouldBeNil)
+		})
+	})
+}
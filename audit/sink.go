@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/ONSdigital/go-ns/avro"
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Sink receives the events recorded by an Auditor, so that services can audit without a Kafka producer
+type Sink interface {
+	// Write stores or sends e, returning once it has done so or failed to
+	Write(ctx context.Context, e Event) error
+}
+
+// NewWithSink creates a new Auditor that writes events to sink, rather than marshalling them for a producer
+func NewWithSink(sink Sink, namespace string) *Auditor {
+	a := New(nil, namespace)
+	a.sink = sink
+	return a
+}
+
+// ProducerSink is a Sink that marshals events with Schema and sends them to an OutboundProducer, for use alongside
+// other sinks in a FanOutSink. Signed events can only be verified once they have been read back if Schema is
+// EventV2Schema.
+type ProducerSink struct {
+	Schema *avro.Schema
+
+	producer OutboundProducer
+}
+
+// NewProducerSink returns a ProducerSink for producer that marshals events with EventSchema
+func NewProducerSink(producer OutboundProducer) *ProducerSink {
+	return &ProducerSink{Schema: EventSchema, producer: producer}
+}
+
+// Write sends e to the producer, giving up if ctx is done first
+func (s *ProducerSink) Write(ctx context.Context, e Event) error {
+	b, err := s.Schema.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case s.producer.Output() <- b:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// JSONLinesSink is a Sink that writes each event as a line of JSON
+type JSONLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesSink returns a JSONLinesSink that writes to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// OpenJSONLinesFile returns a JSONLinesSink that appends to the file at path, creating it if it does not exist. The
+// sink must be closed once it is no longer needed.
+func OpenJSONLinesFile(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesSink(f), nil
+}
+
+// Write writes e to the sink as a single line of JSON
+func (s *JSONLinesSink) Write(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(b)
+	return err
+}
+
+// Close closes the underlying writer if it is an io.Closer
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// LogSink is a Sink that logs each event with log.go, which writes to stdout, for local development
+type LogSink struct{}
+
+// Write logs e
+func (LogSink) Write(ctx context.Context, e Event) error {
+	log.Info(ctx, "audit event", log.Data{"auditEvent": e})
+	return nil
+}
+
+// WebhookSink is a Sink that posts each event as JSON to a URL. Any response other than a 2xx status is an error.
+type WebhookSink struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+}
+
+// NewWebhookSink returns a WebhookSink that posts events to url using the default HTTP client
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Header: http.Header{}, Client: http.DefaultClient}
+}
+
+// Write posts e to the webhook, giving up if ctx is done first
+func (s *WebhookSink) Write(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FailurePolicy sets what a FanOutSink does when one of its sinks fails
+type FailurePolicy int
+
+// Failure policies of the sinks in a FanOutSink
+const (
+	// Required sinks fail the write if they cannot write the event
+	Required FailurePolicy = iota
+	// BestEffort sinks log their failures, which do not fail the write
+	BestEffort
+)
+
+// FanOutTarget is a sink of a FanOutSink and what to do if it fails
+type FanOutTarget struct {
+	Sink   Sink
+	Policy FailurePolicy
+}
+
+// FanOutSink is a Sink that writes each event to several sinks at once
+type FanOutSink struct {
+	targets []FanOutTarget
+}
+
+// NewFanOutSink returns a FanOutSink that writes to each of targets
+func NewFanOutSink(targets ...FanOutTarget) *FanOutSink {
+	return &FanOutSink{targets: targets}
+}
+
+// Write writes e to every sink, returning the errors of any Required sinks that failed
+func (s *FanOutSink) Write(ctx context.Context, e Event) error {
+	errs := make([]error, len(s.targets))
+
+	var wg sync.WaitGroup
+	for i := range s.targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.targets[i].Sink.Write(ctx, e)
+		}(i)
+	}
+	wg.Wait()
+
+	var required []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if s.targets[i].Policy == BestEffort {
+			log.Error(ctx, "best effort audit sink failed to write event", err,
+				log.Data{"sink": fmt.Sprintf("%T", s.targets[i].Sink)})
+			continue
+		}
+		required = append(required, err)
+	}
+	return errors.Join(required...)
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ONSdigital/go-ns/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// sinkFunc adapts a function to the Sink interface
+type sinkFunc func(ctx context.Context, e Event) error
+
+func (f sinkFunc) Write(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+func TestAuditor_RecordToSink(t *testing.T) {
+	Convey("given an auditor writing to a sink", t, func() {
+		var written []Event
+		sink := sinkFunc(func(ctx context.Context, e Event) error {
+			written = append(written, e)
+			return nil
+		})
+		auditor := NewWithSink(sink, service)
+
+		Convey("then recorded events are written to the sink", func() {
+			err := auditor.Record(setUpContext(), auditAction, Successful, common.Params{"ID": "12345"})
+			So(err, ShouldBeNil)
+			So(written, ShouldHaveLength, 1)
+			So(written[0].Service, ShouldEqual, service)
+			So(written[0].User, ShouldEqual, user)
+			So(written[0].Params, ShouldResemble, common.Params{"ID": "12345"})
+		})
+
+		Convey("then errors from the sink are returned", func() {
+			auditor.sink = sinkFunc(func(ctx context.Context, e Event) error { return errors.New("disk full") })
+
+			err := auditor.Record(setUpContext(), auditAction, Successful, nil)
+			So(err, ShouldResemble, NewAuditError("error writing event to sink: disk full", auditAction, Successful, nil))
+		})
+	})
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	Convey("given a JSON lines file", t, func() {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		sink, err := OpenJSONLinesFile(path)
+		So(err, ShouldBeNil)
+
+		Convey("then each event is written on its own line", func() {
+			So(sink.Write(context.Background(), Event{User: "one", Params: common.Params{"ID": "1"}}), ShouldBeNil)
+			So(sink.Write(context.Background(), Event{User: "two"}), ShouldBeNil)
+			So(sink.Close(), ShouldBeNil)
+
+			f, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer f.Close()
+
+			var events []Event
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				var e Event
+				So(json.Unmarshal(scanner.Bytes(), &e), ShouldBeNil)
+				events = append(events, e)
+			}
+			So(events, ShouldResemble, []Event{{User: "one", Params: common.Params{"ID": "1"}}, {User: "two"}})
+		})
+	})
+}
+
+func TestWebhookSink(t *testing.T) {
+	Convey("given a webhook", t, func() {
+		status := http.StatusNoContent
+		var received Event
+		var header http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+			b, _ := io.ReadAll(r.Body)
+			json.Unmarshal(b, &received)
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+
+		sink := NewWebhookSink(server.URL)
+		sink.Header.Set("Authorization", "Bearer token")
+
+		Convey("then events are posted as JSON", func() {
+			So(sink.Write(context.Background(), Event{User: "some-user", AttemptedAction: auditAction}), ShouldBeNil)
+			So(received, ShouldResemble, Event{User: "some-user", AttemptedAction: auditAction})
+			So(header.Get("Content-Type"), ShouldEqual, "application/json")
+			So(header.Get("Authorization"), ShouldEqual, "Bearer token")
+		})
+
+		Convey("then an error status fails the write", func() {
+			status = http.StatusServiceUnavailable
+			So(sink.Write(context.Background(), Event{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFanOutSink(t *testing.T) {
+	Convey("given a fan out sink", t, func() {
+		var buf bytes.Buffer
+		failing := sinkFunc(func(ctx context.Context, e Event) error { return errors.New("unavailable") })
+
+		Convey("then every sink receives the event", func() {
+			output := make(chan []byte, 1)
+			producer := &OutboundProducerMock{OutputFunc: func() chan []byte { return output }}
+			sink := NewFanOutSink(
+				FanOutTarget{Sink: NewJSONLinesSink(&buf)},
+				FanOutTarget{Sink: NewProducerSink(producer)},
+			)
+
+			So(sink.Write(context.Background(), Event{User: user}), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, `"user":"some-user"`)
+
+			var e Event
+			So(EventSchema.Unmarshal(<-output, &e), ShouldBeNil)
+			So(e.User, ShouldEqual, user)
+		})
+
+		Convey("then failures of best effort sinks are ignored", func() {
+			sink := NewFanOutSink(
+				FanOutTarget{Sink: NewJSONLinesSink(&buf)},
+				FanOutTarget{Sink: failing, Policy: BestEffort},
+			)
+			So(sink.Write(context.Background(), Event{User: user}), ShouldBeNil)
+			So(buf.Len(), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("then failures of required sinks fail the write", func() {
+			sink := NewFanOutSink(
+				FanOutTarget{Sink: NewJSONLinesSink(&buf)},
+				FanOutTarget{Sink: failing, Policy: Required},
+			)
+			err := sink.Write(context.Background(), Event{User: user})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unavailable")
+			So(buf.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+}
@@ -0,0 +1,436 @@
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// spoolSegmentSize is the size at which a new spool file is started, so that files can be removed once replayed
+	spoolSegmentSize = 4 << 20
+	// spoolHeaderSize is the size of the header before each event: the time it was spooled, its length and checksum
+	spoolHeaderSize = 16
+	spoolSuffix     = ".spool"
+	spoolCursorFile = "cursor"
+	// maxSpooledSize is the largest event that can be spooled
+	maxSpooledSize = 64 << 20
+)
+
+// ErrCorruptSpool is returned when a spool file contains an event that was not completely written
+var ErrCorruptSpool = errors.New("audit spool is corrupt")
+
+// Spool is a write-ahead log of marshalled audit events held in a directory, which keeps events that could not be
+// handed to the producer until they can be replayed. Events are synced to disk before Append returns and replayed in
+// the order they were added, including by a later process using the same directory. An event is only removed once
+// replaying it succeeds, and its removal is synced to disk, so only an event being replayed when the process stops is
+// sent again by the next one. Files are deleted once every event in them has been replayed.
+// A Spool is safe for concurrent use.
+type Spool struct {
+	dir    string
+	notify chan struct{}
+
+	mu       sync.Mutex
+	segments []uint64
+	file     *os.File
+	size     int64
+	read     *os.File
+	offset   int64
+	cursor   *os.File
+	depth    int
+	oldest   time.Time
+	// nextID is the id of the next spool file to be started
+	nextID uint64
+
+	replaying sync.Mutex
+}
+
+// SpoolStats describes the events waiting in a spool, for health checks
+type SpoolStats struct {
+	// Depth is the number of events waiting to be replayed
+	Depth int
+	// Age is how long the oldest event has been waiting, or zero if there are none
+	Age time.Duration
+}
+
+// NewSpool opens the spool in dir, creating the directory if it does not exist. Events left by an earlier process
+// are kept for replay.
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, notify: make(chan struct{}, 1)}
+	if err := s.open(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open finds the spool files in the directory, works out how many events are still to be replayed and removes any
+// event at the end of the newest file that was not completely written
+func (s *Spool) open() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolSuffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), spoolSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, id)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	if s.cursor, err = os.OpenFile(filepath.Join(s.dir, spoolCursorFile), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return err
+	}
+	s.nextID = 1
+	var position [16]byte
+	if n, _ := s.cursor.ReadAt(position[:], 0); n == len(position) {
+		id, offset := binary.BigEndian.Uint64(position[:8]), int64(binary.BigEndian.Uint64(position[8:]))
+		s.nextID = id
+		for len(s.segments) > 0 && s.segments[0] < id {
+			if err := os.Remove(s.segmentPath(s.segments[0])); err != nil {
+				return err
+			}
+			s.segments = s.segments[1:]
+		}
+		if len(s.segments) > 0 && s.segments[0] == id {
+			s.offset = offset
+		}
+	}
+
+	for i, id := range s.segments {
+		f, err := os.Open(s.segmentPath(id))
+		if err != nil {
+			return err
+		}
+		var start int64
+		if i == 0 {
+			start = s.offset
+		}
+		count, end, oldest, err := scanSegment(f, start)
+		f.Close()
+
+		if err == ErrCorruptSpool && i == len(s.segments)-1 {
+			// the process stopped part way through writing the last event
+			if err = os.Truncate(s.segmentPath(id), end); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, s.segmentPath(id))
+		}
+
+		if s.depth == 0 {
+			s.oldest = oldest
+		}
+		s.depth += count
+		s.size = end
+	}
+
+	if len(s.segments) > 0 {
+		if last := s.segments[len(s.segments)-1]; last >= s.nextID {
+			s.nextID = last + 1
+		}
+		s.file, err = os.OpenFile(s.segmentPath(s.segments[len(s.segments)-1]), os.O_WRONLY|os.O_APPEND, 0600)
+	}
+	return err
+}
+
+// scanSegment counts the events in a spool file after offset, returning where the last complete one ends and when the
+// first was spooled
+func scanSegment(f *os.File, offset int64) (count int, end int64, oldest time.Time, err error) {
+	end = offset
+	for {
+		spooled, message, err := readSpooled(f, end)
+		if err == io.EOF {
+			return count, end, oldest, nil
+		}
+		if err != nil {
+			return count, end, oldest, err
+		}
+		if count == 0 {
+			oldest = spooled
+		}
+		count++
+		end += spoolHeaderSize + int64(len(message))
+	}
+}
+
+// readSpooled reads the event at offset in a spool file, returning io.EOF if there are no more
+func readSpooled(f *os.File, offset int64) (time.Time, []byte, error) {
+	var header [spoolHeaderSize]byte
+	n, err := f.ReadAt(header[:], offset)
+	if n == 0 && err == io.EOF {
+		return time.Time{}, nil, io.EOF
+	}
+	if n < len(header) {
+		return time.Time{}, nil, ErrCorruptSpool
+	}
+
+	spooled := time.Unix(0, int64(binary.BigEndian.Uint64(header[:8])))
+	size := binary.BigEndian.Uint32(header[8:12])
+	if size > maxSpooledSize {
+		return time.Time{}, nil, ErrCorruptSpool
+	}
+	message := make([]byte, size)
+	if _, err := f.ReadAt(message, offset+spoolHeaderSize); err != nil {
+		return time.Time{}, nil, ErrCorruptSpool
+	}
+	if crc32.ChecksumIEEE(message) != binary.BigEndian.Uint32(header[12:]) {
+		return time.Time{}, nil, ErrCorruptSpool
+	}
+	return spooled, message, nil
+}
+
+// Append adds message to the end of the spool, returning once it has been written to disk
+func (s *Spool) Append(message []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cursor == nil {
+		return errors.New("audit spool is closed")
+	}
+	if len(message) > maxSpooledSize {
+		return fmt.Errorf("audit event of %d bytes is too large to spool", len(message))
+	}
+
+	if s.file == nil || s.size > 0 && s.size+spoolHeaderSize+int64(len(message)) > spoolSegmentSize {
+		if err := s.startSegment(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	record := make([]byte, spoolHeaderSize+len(message))
+	binary.BigEndian.PutUint64(record[:8], uint64(now.UnixNano()))
+	binary.BigEndian.PutUint32(record[8:12], uint32(len(message)))
+	binary.BigEndian.PutUint32(record[12:16], crc32.ChecksumIEEE(message))
+	copy(record[spoolHeaderSize:], message)
+
+	if _, err := s.file.Write(record); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.size += int64(len(record))
+
+	if s.depth == 0 {
+		s.oldest = now
+	}
+	s.depth++
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// startSegment starts writing to a new spool file
+func (s *Spool) startSegment() error {
+	id := s.nextID
+	f, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.size = f, 0
+	s.segments = append(s.segments, id)
+	s.nextID = id + 1
+	return nil
+}
+
+// Replay calls send with each spooled event in turn, oldest first, removing it from the spool once send succeeds. It
+// returns nil once the spool is empty, or the first error from send. Only one Replay runs at a time.
+func (s *Spool) Replay(ctx context.Context, send func(ctx context.Context, message []byte) error) error {
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		message, err := s.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := send(ctx, message); err != nil {
+			return err
+		}
+		if err := s.remove(len(message)); err != nil {
+			return err
+		}
+	}
+}
+
+// next returns the oldest event in the spool, or io.EOF if it is empty
+func (s *Spool) next() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.depth == 0 {
+		return nil, io.EOF
+	}
+	_, message, err := s.peek()
+	return message, err
+}
+
+// remove removes the oldest event, of the given size, from the spool
+func (s *Spool) remove(size int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset += spoolHeaderSize + int64(size)
+	s.depth--
+	s.oldest = time.Time{}
+	if s.depth == 0 {
+		return s.removeReplayed()
+	}
+	spooled, _, err := s.peek()
+	if err != nil {
+		return err
+	}
+	s.oldest = spooled
+	return s.saveCursor()
+}
+
+// removeReplayed deletes the spool files once every event in them has been replayed
+func (s *Spool) removeReplayed() error {
+	for _, f := range []*os.File{s.file, s.read} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	s.file, s.read, s.size = nil, nil, 0
+
+	// the cursor is moved past the files first, so that none are replayed again if they cannot all be removed
+	segments := s.segments
+	s.segments, s.offset = nil, 0
+	if err := s.saveCursor(); err != nil {
+		return err
+	}
+	for _, id := range segments {
+		if err := os.Remove(s.segmentPath(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peek reads the event at the current position, moving on to the next file once the first has been replayed
+func (s *Spool) peek() (time.Time, []byte, error) {
+	for {
+		if s.read == nil {
+			f, err := os.Open(s.segmentPath(s.segments[0]))
+			if err != nil {
+				return time.Time{}, nil, err
+			}
+			s.read = f
+		}
+
+		spooled, message, err := readSpooled(s.read, s.offset)
+		if err != io.EOF {
+			return spooled, message, err
+		}
+		if err := s.removeSegment(); err != nil {
+			return time.Time{}, nil, err
+		}
+	}
+}
+
+// removeSegment deletes the first spool file, which has been completely replayed
+func (s *Spool) removeSegment() error {
+	if len(s.segments) < 2 {
+		return ErrCorruptSpool
+	}
+	if s.read != nil {
+		s.read.Close()
+		s.read = nil
+	}
+	if err := os.Remove(s.segmentPath(s.segments[0])); err != nil {
+		return err
+	}
+	s.segments = s.segments[1:]
+	s.offset = 0
+	return s.saveCursor()
+}
+
+// saveCursor records the position of the oldest event so that replaying carries on from it after a restart,
+// returning once it has been written to disk
+func (s *Spool) saveCursor() error {
+	id := s.nextID
+	if len(s.segments) > 0 {
+		id = s.segments[0]
+	}
+
+	var position [16]byte
+	binary.BigEndian.PutUint64(position[:8], id)
+	binary.BigEndian.PutUint64(position[8:], uint64(s.offset))
+	if _, err := s.cursor.WriteAt(position[:], 0); err != nil {
+		return err
+	}
+	return s.cursor.Sync()
+}
+
+// Depth returns the number of events waiting to be replayed
+func (s *Spool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Stats returns the number of events waiting to be replayed and the age of the oldest
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SpoolStats{Depth: s.depth}
+	if s.depth > 0 {
+		stats.Age = time.Since(s.oldest)
+	}
+	return stats
+}
+
+// Close closes the files of the spool. Events that have not been replayed are kept for the next process to open it.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, f := range []*os.File{s.file, s.read, s.cursor} {
+		if f != nil {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	s.file, s.read, s.cursor = nil, nil, nil
+	return err
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolSuffix))
+}
@@ -0,0 +1,179 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// replayAll returns the events replayed from spool, stopping with an error after limit events if limit is positive
+func replayAll(spool *Spool, limit int) ([]string, error) {
+	var replayed []string
+	err := spool.Replay(context.Background(), func(ctx context.Context, message []byte) error {
+		if limit > 0 && len(replayed) == limit {
+			return errors.New("producer unavailable")
+		}
+		replayed = append(replayed, string(message))
+		return nil
+	})
+	return replayed, err
+}
+
+func TestSpool(t *testing.T) {
+	Convey("given a new spool", t, func() {
+		dir := filepath.Join(t.TempDir(), "spool")
+		spool, err := NewSpool(dir)
+		So(err, ShouldBeNil)
+		defer spool.Close()
+
+		So(spool.Stats(), ShouldResemble, SpoolStats{})
+
+		Convey("then events are replayed in the order they were added", func() {
+			for _, event := range []string{"one", "two", "three"} {
+				So(spool.Append([]byte(event)), ShouldBeNil)
+			}
+			stats := spool.Stats()
+			So(stats.Depth, ShouldEqual, 3)
+			So(stats.Age, ShouldBeGreaterThan, 0)
+
+			replayed, err := replayAll(spool, 0)
+			So(err, ShouldBeNil)
+			So(replayed, ShouldResemble, []string{"one", "two", "three"})
+			So(spool.Stats(), ShouldResemble, SpoolStats{})
+		})
+
+		Convey("then events that could not be replayed are kept after a restart", func() {
+			for _, event := range []string{"one", "two", "three"} {
+				So(spool.Append([]byte(event)), ShouldBeNil)
+			}
+
+			replayed, err := replayAll(spool, 1)
+			So(err, ShouldNotBeNil)
+			So(replayed, ShouldResemble, []string{"one"})
+			So(spool.Close(), ShouldBeNil)
+
+			reopened, err := NewSpool(dir)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+			So(reopened.Depth(), ShouldEqual, 2)
+
+			replayed, err = replayAll(reopened, 0)
+			So(err, ShouldBeNil)
+			So(replayed, ShouldResemble, []string{"two", "three"})
+		})
+
+		Convey("then an event that was not completely written is discarded when the spool is reopened", func() {
+			So(spool.Append([]byte("one")), ShouldBeNil)
+			So(spool.Close(), ShouldBeNil)
+
+			files, err := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+			f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0600)
+			So(err, ShouldBeNil)
+			_, err = f.Write([]byte{0, 0, 0, 1, 2})
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+
+			reopened, err := NewSpool(dir)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+			So(reopened.Depth(), ShouldEqual, 1)
+
+			So(reopened.Append([]byte("two")), ShouldBeNil)
+			replayed, err := replayAll(reopened, 0)
+			So(err, ShouldBeNil)
+			So(replayed, ShouldResemble, []string{"one", "two"})
+		})
+
+		Convey("then files are removed once their events have been replayed", func() {
+			large := bytes.Repeat([]byte("a"), spoolSegmentSize/2)
+			for i := 0; i < 3; i++ {
+				So(spool.Append(large), ShouldBeNil)
+			}
+			files, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+			So(files, ShouldHaveLength, 3)
+
+			replayed, err := replayAll(spool, 2)
+			So(err, ShouldNotBeNil)
+			So(replayed, ShouldHaveLength, 2)
+
+			files, _ = filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+			So(files, ShouldHaveLength, 1)
+			So(spool.Depth(), ShouldEqual, 1)
+		})
+
+		Convey("then the last file is removed once every event has been replayed", func() {
+			So(spool.Append([]byte("one")), ShouldBeNil)
+			_, err := replayAll(spool, 0)
+			So(err, ShouldBeNil)
+			files, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+			So(files, ShouldBeEmpty)
+
+			Convey("and events added afterwards are kept after a restart", func() {
+				So(spool.Append([]byte("two")), ShouldBeNil)
+				So(spool.Close(), ShouldBeNil)
+
+				reopened, err := NewSpool(dir)
+				So(err, ShouldBeNil)
+				defer reopened.Close()
+
+				replayed, err := replayAll(reopened, 0)
+				So(err, ShouldBeNil)
+				So(replayed, ShouldResemble, []string{"two"})
+			})
+		})
+	})
+}
+
+func TestAuditor_RecordSpooled(t *testing.T) {
+	Convey("given an auditor with a spool and a producer that is not reading its output channel", t, func() {
+		spool, err := NewSpool(t.TempDir())
+		So(err, ShouldBeNil)
+		defer spool.Close()
+
+		output := make(chan []byte)
+		producer := &OutboundProducerMock{
+			OutputFunc: func() chan []byte { return output },
+		}
+		auditor := NewWithDelivery(producer, service, DeliveryConfig{Timeout: 10 * time.Millisecond, Spool: spool})
+
+		Convey("then events are spooled rather than failing the request", func() {
+			So(auditor.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+			So(auditor.Record(setUpContext(), auditAction, Successful, nil), ShouldBeNil)
+			So(spool.Depth(), ShouldBeGreaterThanOrEqualTo, 1)
+
+			Convey("and replayed in order once the producer recovers", func() {
+				for _, result := range []string{Attempted, Successful} {
+					var e Event
+					select {
+					case message := <-output:
+						So(EventSchema.Unmarshal(message, &e), ShouldBeNil)
+					case <-time.After(5 * time.Second):
+						t.Fatal("expected a spooled event to be replayed")
+					}
+					So(e.ActionResult, ShouldEqual, result)
+				}
+				So(auditor.Close(context.Background()), ShouldBeNil)
+				So(spool.Depth(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("then events are spooled after the default timeout if the auditor has none", func() {
+			So(auditor.Close(context.Background()), ShouldBeNil)
+			defaulted := NewWithDelivery(producer, service, DeliveryConfig{Spool: spool})
+			defer defaulted.Close(context.Background())
+
+			start := time.Now()
+			So(defaulted.Record(setUpContext(), auditAction, Attempted, nil), ShouldBeNil)
+			So(time.Since(start), ShouldBeBetween, DefaultSpoolTimeout/2, DefaultSpoolTimeout*5)
+			So(spool.Depth(), ShouldEqual, 1)
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package avro
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
@@ -143,8 +144,7 @@ func TestUnitMarshal(t *testing.T) {
 		}
 
 		bufferBytes, err := schema.Marshal(data)
-		So(err, ShouldNotBeNil)
-		So(err, ShouldEqual, ErrUnsupportedFieldType)
+		So(errors.Is(err, ErrUnsupportedFieldType), ShouldBeTrue)
 		So(bufferBytes, ShouldBeNil)
 	})
 }
@@ -152,18 +152,22 @@ func TestUnitMarshal(t *testing.T) {
 // Test checkFieldType function
 func TestUnitCheckFieldType(t *testing.T) {
 	Convey("Successfully return without error", t, func() {
-		_, v, t := setUp(testSchema, 1)
+		_, _, typ := setUp(testSchema, 1)
 
-		err := checkFieldType(v, t)
+		err := checkFieldType(typ)
 		So(err, ShouldBeNil)
 	})
 
 	Convey("Error on unsupported field type", t, func() {
-		_, v, t := setUp(testSchema, 2)
+		_, _, typ := setUp(testSchema, 2)
 
-		err := checkFieldType(v, t)
-		So(err, ShouldNotBeNil)
-		So(err, ShouldResemble, ErrUnsupportedFieldType)
+		err := checkFieldType(typ)
+		So(errors.Is(err, ErrUnsupportedFieldType), ShouldBeTrue)
+
+		var fieldErr *FieldError
+		So(errors.As(err, &fieldErr), ShouldBeTrue)
+		So(fieldErr.Path, ShouldEqual, "NumberOfYouths")
+		So(fieldErr.Field, ShouldEqual, "number_of_youths")
 	})
 }
 
@@ -204,11 +208,28 @@ func TestUnitIsValidType(t *testing.T) {
 			isValid := isValidType(reflect.Struct)
 			So(isValid, ShouldEqual, true)
 		})
+
+		Convey("returned true for float types", func() {
+			So(isValidType(reflect.Float32), ShouldEqual, true)
+			So(isValidType(reflect.Float64), ShouldEqual, true)
+		})
+
+		Convey("returned true for other integer types", func() {
+			So(isValidType(reflect.Int), ShouldEqual, true)
+			So(isValidType(reflect.Uint8), ShouldEqual, true)
+		})
+
+		Convey("returned true for pointer and array types", func() {
+			So(isValidType(reflect.Ptr), ShouldEqual, true)
+			So(isValidType(reflect.Array), ShouldEqual, true)
+		})
 	})
 
 	Convey("Return false for unsupported type", t, func() {
-		isValid := isValidType(reflect.Float32)
-		So(isValid, ShouldEqual, false)
+		So(isValidType(reflect.Uintptr), ShouldEqual, false)
+		So(isValidType(reflect.Complex64), ShouldEqual, false)
+		So(isValidType(reflect.Chan), ShouldEqual, false)
+		So(isValidType(reflect.Func), ShouldEqual, false)
 	})
 }
 
@@ -241,7 +262,7 @@ func TestUnitGetRecord(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(record, ShouldNotBeNil)
 			So(record, ShouldHaveSameTypeAs, avro.NewGenericRecord(avroSchema))
-			So(record.Get("winning_years"), ShouldResemble, []interface{}(nil))
+			So(record.Get("winning_years"), ShouldBeNil)
 		})
 
 		Convey("record generated with nested array", func() {
@@ -258,117 +279,115 @@ func TestUnitGetRecord(t *testing.T) {
 	})
 }
 
-// Test marshalSlice function
-func TestUnitMarshalSlice(t *testing.T) {
-	Convey("Successfully marshal string slice", t, func() {
-		avroSchema, v, typ := setUp(testArraySchema, 3)
-		record, _ := getRecord(avroSchema, v, typ)
+// getRecord marshals v and reads it back with the go-avro generic reader, so that the tests written against the
+// generic records Marshal used to build check that the same records are still encoded
+func getRecord(avroSchema avro.Schema, v reflect.Value, _ reflect.Type) (*avro.GenericRecord, error) {
+	b, err := (&Schema{Definition: avroSchema.String()}).Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
 
-		err := marshalSlice(record, v, 0, "string_slice", avroSchema)
-		So(err, ShouldBeNil)
-	})
+	reader := avro.NewGenericDatumReader()
+	reader.SetSchema(avroSchema)
+	record := avro.NewGenericRecord(avroSchema)
+	if err := reader.Read(record, avro.NewBinaryDecoder(b)); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
 
-	Convey("Successfully marshal struct slice", t, func() {
-		avroSchema, v, typ := setUp(testNestedArraySchema, 4)
-		record, _ := getRecord(avroSchema, v, typ)
+func TestUnitUnmarshal(t *testing.T) {
+	Convey("Arrays of strings and structs round trip", t, func() {
+		schema := &Schema{Definition: testNestedArraySchema}
+		_, v, _ := setUp(testNestedArraySchema, 4)
+
+		b, err := schema.Marshal(v.Interface())
+		So(err, ShouldBeNil)
 
-		err := marshalSlice(record, v, 1, "footballers", avroSchema)
+		var actual testData4
+		err = schema.Unmarshal(b, &actual)
 		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, v.Interface())
 	})
 
-	Convey("Fail to marshal struct slice", t, func() {
-		avroSchema, v, typ := setUp(testNestedArraySchema, 4)
-		record, _ := getRecord(avroSchema, v, typ)
+	Convey("A nullable array of strings round trips", t, func() {
+		schema := &Schema{Definition: testArraySchema}
 
-		err := marshalSlice(record, v, 1, "footballer", avroSchema)
-		So(err, ShouldNotBeNil)
-		So(err, ShouldResemble, ErrMissingNestedScema)
+		b, err := schema.Marshal(&testData3{WinningYears: []string{"1934", "1972", "1999"}})
+		So(err, ShouldBeNil)
+
+		var actual testData3
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual.WinningYears, ShouldResemble, []string{"1934", "1972", "1999"})
 	})
-}
 
-// Test marshalStringSlice function
-func TestUnitMarshalStringSlice(t *testing.T) {
-	Convey("Successfully marshal string slice", t, func() {
-		_, v, _ := setUp(testArraySchema, 3)
+	Convey("A missing nullable array is unmarshalled as nil", t, func() {
+		schema := &Schema{Definition: testArraySchema}
 
-		slice := marshalStringSlice(v, 0)
-		So(slice, ShouldNotBeEmpty)
-		So(slice, ShouldResemble, []interface{}{"1934", "1972", "1999"})
+		b, err := schema.Marshal(&testData5{})
+		So(err, ShouldBeNil)
+
+		actual := testData5{WinningYears: []string{"1966"}}
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual.WinningYears, ShouldBeNil)
 	})
-}
 
-// Test marshalStructSlice function
-func TestUnitMarshalStructSlice(t *testing.T) {
-	Convey("Successfully marshal struct slice", t, func() {
-		avroSchema, v, _ := setUp(testNestedArraySchema, 4)
+	Convey("Schema fields that are not in the struct are skipped", t, func() {
+		schema := &Schema{Definition: testSchema}
+
+		b, err := schema.Marshal(&testData{Manager: "Pardew, Alan", URI: "http://8080/cpfc.com", PayPerWeek: 10})
+		So(err, ShouldBeNil)
 
-		slice, err := marshalStructSlice(v, 1, avroSchema, "footballers")
+		var actual testData1
+		err = schema.Unmarshal(b, &actual)
 		So(err, ShouldBeNil)
-		So(slice, ShouldNotBeEmpty)
+		So(actual, ShouldResemble, testData1{Manager: "Pardew, Alan", PayPerWeek: 10})
 	})
 
-	Convey("Throws error due to missing nested schema", t, func() {
-		avroSchema, v, _ := setUp(testNestedArraySchema, 4)
+	Convey("Unmarshal should return an error unless given a pointer to a struct", t, func() {
+		schema := &Schema{Definition: testSchema}
 
-		slice, err := marshalStructSlice(v, 1, avroSchema, "footballer")
-		So(err, ShouldNotBeNil)
-		So(err, ShouldResemble, ErrMissingNestedScema)
-		So(slice, ShouldBeNil)
+		err := schema.Unmarshal([]byte{}, testData{})
+		So(err, ShouldResemble, ErrUnsupportedType(reflect.Struct))
+
+		str := "string"
+		err = schema.Unmarshal([]byte{}, &str)
+		So(err, ShouldResemble, ErrUnsupportedType(reflect.String))
 	})
-}
 
-// Test getArraySchema function
-func TestUnitGetArraySchema(t *testing.T) {
-	avroSchema, _, _ := setUp(testSchema, 0)
+	Convey("Unmarshal should return an error for a truncated message", t, func() {
+		schema := &Schema{Definition: testSchema}
 
-	Convey("Successfully retrieve array schema", t, func() {
-		newSchema, err := getArraySchema(avroSchema, "manager")
+		b, err := schema.Marshal(&testData{Manager: "Pardew, Alan"})
 		So(err, ShouldBeNil)
-		So(newSchema, ShouldNotBeEmpty)
-	})
 
-	Convey("Error retrieving array schema", t, func() {
-		newSchema, err := getArraySchema(avroSchema, "managers")
+		var actual testData
+		err = schema.Unmarshal(b[:len(b)-1], &actual)
 		So(err, ShouldNotBeNil)
-		So(err, ShouldResemble, ErrMissingNestedScema)
-		So(newSchema, ShouldBeNil)
 	})
-}
 
-// Test getNestedSchema function
-func TestUnitGetNestedSchema(t *testing.T) {
-	Convey("Successfully retrieve nested schema", t, func() {
-		avroSchema, v, t := setUp(testNestedArraySchema, 4)
+	Convey("Marshal should return an error if the struct has no value for a field without a default", t, func() {
+		schema := &Schema{Definition: testSchema}
 
-		newSchema, err := getNestedSchema(avroSchema, "footballers", v, t)
-		So(err, ShouldBeNil)
-		So(newSchema, ShouldNotBeEmpty)
+		b, err := schema.Marshal(&testData3{})
+		So(err, ShouldResemble, ErrMissingField("manager"))
+		So(b, ShouldBeNil)
 	})
 
-	Convey("Error retrieving nested schema", t, func() {
-		avroSchema, v, t := setUp(testNestedArraySchema, 4)
+	Convey("An invalid schema definition returns an error", t, func() {
+		schema := &Schema{Definition: `{"type": "record", "name": "broken", "fields": [`}
+
+		b, err := schema.Marshal(&testData{})
+		So(err, ShouldNotBeNil)
+		So(b, ShouldBeNil)
 
-		newSchema, err := getNestedSchema(avroSchema, "footballer", v, t)
+		err = schema.Unmarshal([]byte{}, &testData{})
 		So(err, ShouldNotBeNil)
-		So(err, ShouldResemble, ErrMissingNestedScema)
-		So(newSchema, ShouldBeNil)
 	})
 }
 
-// TODO Test Unmarshal function
-
-// TODO -- Test populateStructFromSchema function
-
-// TODO -- -- Test generateDecodedRecord function
-
-// TODO -- -- Test unmarshalStringSlice function
-
-// TODO -- -- Test unmarshalStructSlice function
-
-// TODO -- -- -- Test populateNestedArrayItem function
-
-// TODO -- -- -- -- Test setNestedStructs function
-
 func setUp(testSchema string, dataSet int) (avro.Schema, reflect.Value, reflect.Type) {
 	avroSchema, _ := avro.ParseSchema(testSchema)
 
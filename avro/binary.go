@@ -0,0 +1,281 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+// maxBlockLength limits the size of any single string, bytes value or collection block read from a message, so a
+// corrupt length prefix cannot make the decoder allocate an arbitrary amount of memory.
+const maxBlockLength = 1 << 26
+
+var (
+	errVarintOverflow = errors.New("varint overflows a 64-bit integer")
+	errInvalidLength  = errors.New("invalid length prefix")
+	errInvalidBoolean = errors.New("invalid boolean value")
+)
+
+// encoder appends the avro binary encoding of values to a buffer
+type encoder struct {
+	buf []byte
+
+	// depth is the number of records enclosing the value being encoded
+	depth int
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return &encoder{buf: make([]byte, 0, 256)}
+	},
+}
+
+func (e *encoder) writeBoolean(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+		return
+	}
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) writeInt(i int32) {
+	e.writeLong(int64(i))
+}
+
+func (e *encoder) writeLong(i int64) {
+	u := uint64((i << 1) ^ (i >> 63))
+	for u >= 0x80 {
+		e.buf = append(e.buf, byte(u)|0x80)
+		u >>= 7
+	}
+	e.buf = append(e.buf, byte(u))
+}
+
+func (e *encoder) writeFloat(f float32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(f))
+}
+
+func (e *encoder) writeDouble(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeLong(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeLong(int64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// streamBufferSize is the amount a decoder reading from a stream reads at once
+const streamBufferSize = 4096
+
+// decoder reads avro binary encoded values from a buffer, which is refilled from r, if it is set, as it is read
+type decoder struct {
+	buf []byte
+	pos int
+	r   io.Reader
+
+	// dropped counts the bytes discarded from the start of the buffer when it is refilled
+	dropped int
+	// depth is the number of records enclosing the value being decoded
+	depth int
+}
+
+// consumed returns the number of bytes read so far
+func (d *decoder) consumed() int {
+	return d.dropped + d.pos
+}
+
+// fill reads from the decoder's reader until at least n unread bytes are buffered. The bytes already read are dropped
+// first, so the buffer only grows as large as the largest single value read from the stream.
+func (d *decoder) fill(n int) error {
+	if d.r == nil || n > maxBlockLength {
+		return io.ErrUnexpectedEOF
+	}
+
+	unread := len(d.buf) - d.pos
+	d.dropped += d.pos
+	size := streamBufferSize
+	if n > size {
+		size = n
+	}
+	if cap(d.buf) < n || cap(d.buf) > 2*size && unread <= size {
+		buf := make([]byte, unread, size)
+		copy(buf, d.buf[d.pos:])
+		d.buf = buf
+	} else {
+		d.buf = d.buf[:copy(d.buf, d.buf[d.pos:])]
+	}
+	d.pos = 0
+
+	for empty := 0; len(d.buf) < n; {
+		read, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+read]
+		if read == 0 && err == nil {
+			if empty++; empty == 100 {
+				return io.ErrNoProgress
+			}
+		}
+		if err == io.EOF && len(d.buf) < n {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil && len(d.buf) < n {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		if err := d.fill(1); err != nil {
+			return 0, err
+		}
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b, nil
+}
+
+// next returns the next n bytes of the buffer without copying them. They are only valid until the next read.
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n > len(d.buf)-d.pos {
+		if err := d.fill(n); err != nil {
+			return nil, err
+		}
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// capacity bounds the space allocated up front for a collection of count items by the number of bytes left to read, so
+// that a corrupt count cannot cause a huge allocation before any items have been read
+func (d *decoder) capacity(count int) int {
+	if remaining := len(d.buf) - d.pos; count > remaining {
+		return remaining
+	}
+	return count
+}
+
+func (d *decoder) readBoolean() (bool, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
+	switch b {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, errInvalidBoolean
+}
+
+func (d *decoder) readInt() (int32, error) {
+	i, err := d.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return 0, errVarintOverflow
+	}
+	return int32(i), nil
+}
+
+func (d *decoder) readLong() (int64, error) {
+	var u uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		u |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return int64(u>>1) ^ -int64(u&1), nil
+		}
+	}
+	return 0, errVarintOverflow
+}
+
+func (d *decoder) readFloat() (float32, error) {
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+}
+
+func (d *decoder) readDouble() (float64, error) {
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+// readLength reads the length prefix of a string or bytes value
+func (d *decoder) readLength() (int, error) {
+	l, err := d.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if l < 0 || l > maxBlockLength {
+		return 0, errInvalidLength
+	}
+	return int(l), nil
+}
+
+func (d *decoder) readBytes() ([]byte, error) {
+	l, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.next(l)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (d *decoder) readString() (string, error) {
+	l, err := d.readLength()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(l)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readBlockCount reads the item count at the start of an array or map block. Negative counts are followed by the
+// size of the block in bytes, which is not needed when reading every item.
+func (d *decoder) readBlockCount() (int, error) {
+	count, err := d.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		if count == math.MinInt64 {
+			return 0, errInvalidLength
+		}
+		count = -count
+		if _, err = d.readLong(); err != nil {
+			return 0, err
+		}
+	}
+	if count > maxBlockLength {
+		return 0, errInvalidLength
+	}
+	return int(count), nil
+}
@@ -0,0 +1,1035 @@
+package avro
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// encodeFunc writes the avro encoding of v, a value of the Go type the function was compiled for
+type encodeFunc func(e *encoder, v reflect.Value) error
+
+// decodeFunc reads an avro value into v, an addressable value of the Go type the function was compiled for
+type decodeFunc func(d *decoder, v reflect.Value) error
+
+// codec is the compiled form of a Schema. The definition is parsed once and the encoders and decoders built for each
+// Go type are kept so that reflection over struct tags only happens the first time a type is seen. A codec is safe for
+// concurrent use.
+type codec struct {
+	schema   *schemaNode
+	encoders sync.Map
+	decoders sync.Map
+
+	// resolvers holds the decoders for data written with other schemas, by writer codec and Go type
+	resolvers sync.Map
+}
+
+func newCodec(definition string) (*codec, error) {
+	n, err := parseSchema(definition)
+	if err != nil {
+		return nil, err
+	}
+	return &codec{schema: n}, nil
+}
+
+// encoderFor returns the encoder for values of type t, compiling it if this is the first time t has been seen
+func (c *codec) encoderFor(t reflect.Type) (encodeFunc, error) {
+	if f, ok := c.encoders.Load(t); ok {
+		return f.(encodeFunc), nil
+	}
+
+	f, err := newCompiler().encoder(c.schema, t)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := c.encoders.LoadOrStore(t, f)
+	return actual.(encodeFunc), nil
+}
+
+// decoderFor returns the decoder for values of type t, compiling it if this is the first time t has been seen
+func (c *codec) decoderFor(t reflect.Type) (decodeFunc, error) {
+	if f, ok := c.decoders.Load(t); ok {
+		return f.(decodeFunc), nil
+	}
+
+	f, err := newCompiler().decoder(c.schema, t)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := c.decoders.LoadOrStore(t, f)
+	return actual.(decodeFunc), nil
+}
+
+// planKey identifies a compiled plan by the schema and Go type it binds together
+type planKey struct {
+	node *schemaNode
+	typ  reflect.Type
+}
+
+// compiler builds the encoders and decoders for a single Go type. Plans for records are remembered while compiling
+// so that recursive schemas resolve to the plan already being built rather than compiling forever.
+type compiler struct {
+	encoders  map[planKey]*encodeFunc
+	decoders  map[planKey]*decodeFunc
+	resolving map[resolvingKey]*decodeFunc
+
+	// depth is the number of records enclosing the type currently being compiled
+	depth int
+}
+
+func newCompiler() *compiler {
+	return &compiler{
+		encoders:  make(map[planKey]*encodeFunc),
+		decoders:  make(map[planKey]*decodeFunc),
+		resolving: make(map[resolvingKey]*decodeFunc),
+	}
+}
+
+func (c *compiler) encoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	switch n.kind {
+	case kindNull:
+		return func(e *encoder, v reflect.Value) error { return nil }, nil
+	case kindUnion:
+		return c.unionEncoder(n, t)
+	}
+
+	switch t {
+	case timeType:
+		return timeEncoder(n)
+	case ratType, ratPtrType:
+		return decimalEncoder(n, t)
+	case durationType:
+		if durationUnit(n) != 0 {
+			return durationEncoder(n), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return c.pointerEncoder(n, t)
+	case reflect.Bool:
+		if n.kind == kindBoolean {
+			return func(e *encoder, v reflect.Value) error {
+				e.writeBoolean(v.Bool())
+				return nil
+			}, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return intEncoder(n, t)
+	case reflect.Float32, reflect.Float64:
+		switch n.kind {
+		case kindFloat:
+			return func(e *encoder, v reflect.Value) error {
+				e.writeFloat(float32(v.Float()))
+				return nil
+			}, nil
+		case kindDouble:
+			return func(e *encoder, v reflect.Value) error {
+				e.writeDouble(v.Float())
+				return nil
+			}, nil
+		}
+	case reflect.String:
+		switch n.kind {
+		case kindString, kindBytes:
+			return func(e *encoder, v reflect.Value) error {
+				e.writeString(v.String())
+				return nil
+			}, nil
+		case kindEnum:
+			return enumEncoder(n), nil
+		}
+	case reflect.Array:
+		if n.kind == kindFixed && t.Elem().Kind() == reflect.Uint8 && t.Len() == n.size {
+			return func(e *encoder, v reflect.Value) error {
+				for i := 0; i < n.size; i++ {
+					e.buf = append(e.buf, byte(v.Index(i).Uint()))
+				}
+				return nil
+			}, nil
+		}
+	case reflect.Struct:
+		if n.kind != kindRecord {
+			return nil, ErrMissingNestedScema
+		}
+		return c.recordEncoder(n, t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && (n.kind == kindBytes || n.kind == kindFixed) {
+			return bytesEncoder(n), nil
+		}
+		if n.kind == kindArray {
+			return c.arrayEncoder(n, t)
+		}
+	case reflect.Map:
+		if n.kind == kindMap {
+			return c.mapEncoder(n, t)
+		}
+	default:
+		return nil, ErrUnsupportedFieldType
+	}
+	return nil, ErrTypeMismatch(t, n.typeName())
+}
+
+func (c *compiler) decoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	switch n.kind {
+	case kindNull:
+		return func(d *decoder, v reflect.Value) error { return nil }, nil
+	case kindUnion:
+		return c.unionDecoder(n, t)
+	}
+
+	switch t {
+	case timeType:
+		return timeDecoder(n)
+	case ratType, ratPtrType:
+		return decimalDecoder(n, t)
+	case durationType:
+		if durationUnit(n) != 0 {
+			return durationDecoder(n), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return c.pointerDecoder(n, t)
+	case reflect.Bool:
+		if n.kind == kindBoolean {
+			return func(d *decoder, v reflect.Value) error {
+				b, err := d.readBoolean()
+				v.SetBool(b)
+				return err
+			}, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return intDecoder(n, t)
+	case reflect.Float32, reflect.Float64:
+		switch n.kind {
+		case kindFloat:
+			return func(d *decoder, v reflect.Value) error {
+				f, err := d.readFloat()
+				v.SetFloat(float64(f))
+				return err
+			}, nil
+		case kindDouble:
+			return func(d *decoder, v reflect.Value) error {
+				f, err := d.readDouble()
+				v.SetFloat(f)
+				return err
+			}, nil
+		}
+	case reflect.String:
+		switch n.kind {
+		case kindString, kindBytes:
+			return func(d *decoder, v reflect.Value) error {
+				s, err := d.readString()
+				v.SetString(s)
+				return err
+			}, nil
+		case kindEnum:
+			return enumDecoder(n), nil
+		}
+	case reflect.Array:
+		if n.kind == kindFixed && t.Elem().Kind() == reflect.Uint8 && t.Len() == n.size {
+			return func(d *decoder, v reflect.Value) error {
+				b, err := d.next(n.size)
+				if err != nil {
+					return err
+				}
+				reflect.Copy(v, reflect.ValueOf(b))
+				return nil
+			}, nil
+		}
+	case reflect.Struct:
+		if n.kind != kindRecord {
+			return nil, ErrMissingNestedScema
+		}
+		return c.recordDecoder(n, t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && (n.kind == kindBytes || n.kind == kindFixed) {
+			return bytesDecoder(n, t), nil
+		}
+		if n.kind == kindArray {
+			return c.arrayDecoder(n, t)
+		}
+	case reflect.Map:
+		if n.kind == kindMap {
+			return c.mapDecoder(n, t)
+		}
+	default:
+		return nil, ErrUnsupportedFieldType
+	}
+	return nil, ErrTypeMismatch(t, n.typeName())
+}
+
+// intRange returns the range of values that can be held by an avro int or long
+func intRange(n *schemaNode) (int64, int64) {
+	if n.kind == kindInt {
+		return math.MinInt32, math.MaxInt32
+	}
+	return math.MinInt64, math.MaxInt64
+}
+
+// intEncoder encodes any Go integer type as an avro int or long, returning an error for values that do not fit
+func intEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	if n.kind == kindEnum {
+		return func(e *encoder, v reflect.Value) error {
+			i, ok := intValue(v)
+			if !ok || i < 0 || i >= int64(len(n.symbols)) {
+				return fmt.Errorf("%v is not a valid ordinal for avro enum %s", v, n.typeName())
+			}
+			e.writeLong(i)
+			return nil
+		}, nil
+	}
+	if n.kind != kindInt && n.kind != kindLong {
+		return nil, ErrTypeMismatch(t, n.typeName())
+	}
+
+	min, max := intRange(n)
+	return func(e *encoder, v reflect.Value) error {
+		i, ok := intValue(v)
+		if !ok || i < min || i > max {
+			return fmt.Errorf("%v overflows avro %s", v, n.kind)
+		}
+		e.writeLong(i)
+		return nil
+	}, nil
+}
+
+// intValue returns the value of any Go integer as an int64, reporting false if an unsigned value is too large
+func intValue(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		return int64(u), u <= math.MaxInt64
+	}
+	return v.Int(), true
+}
+
+func intDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	switch n.kind {
+	case kindInt, kindLong, kindEnum:
+	default:
+		return nil, ErrTypeMismatch(t, n.typeName())
+	}
+
+	min, max := intRange(n)
+	signed := t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64
+	return func(d *decoder, v reflect.Value) error {
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if i < min || i > max || n.kind == kindEnum && (i < 0 || i >= int64(len(n.symbols))) {
+			return fmt.Errorf("%d is not a valid avro %s", i, n.typeName())
+		}
+		if signed {
+			if v.OverflowInt(i) {
+				return fmt.Errorf("%d overflows %v", i, t)
+			}
+			v.SetInt(i)
+			return nil
+		}
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return fmt.Errorf("%d overflows %v", i, t)
+		}
+		v.SetUint(uint64(i))
+		return nil
+	}, nil
+}
+
+// enumEncoder encodes a string as the index of the matching enum symbol
+func enumEncoder(n *schemaNode) encodeFunc {
+	indexes := make(map[string]int64, len(n.symbols))
+	for i, symbol := range n.symbols {
+		indexes[symbol] = int64(i)
+	}
+
+	return func(e *encoder, v reflect.Value) error {
+		i, ok := indexes[v.String()]
+		if !ok {
+			return fmt.Errorf("%q is not a symbol of avro enum %s", v.String(), n.typeName())
+		}
+		e.writeLong(i)
+		return nil
+	}
+}
+
+func enumDecoder(n *schemaNode) decodeFunc {
+	return func(d *decoder, v reflect.Value) error {
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(n.symbols)) {
+			return fmt.Errorf("%d is not a valid index for avro enum %s", i, n.typeName())
+		}
+		v.SetString(n.symbols[i])
+		return nil
+	}
+}
+
+// bytesEncoder encodes a byte slice as avro bytes, or as a fixed type if it is the right length
+func bytesEncoder(n *schemaNode) encodeFunc {
+	if n.kind == kindFixed {
+		return func(e *encoder, v reflect.Value) error {
+			if v.Len() != n.size {
+				return fmt.Errorf("%d bytes cannot be encoded as avro %s of size %d", v.Len(), n.typeName(), n.size)
+			}
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+	}
+	return func(e *encoder, v reflect.Value) error {
+		e.writeBytes(v.Bytes())
+		return nil
+	}
+}
+
+func bytesDecoder(n *schemaNode, t reflect.Type) decodeFunc {
+	return func(d *decoder, v reflect.Value) error {
+		var b []byte
+		var err error
+		if n.kind == kindFixed {
+			b, err = d.next(n.size)
+			b = append([]byte(nil), b...)
+		} else {
+			b, err = d.readBytes()
+		}
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(b).Convert(t))
+		return nil
+	}
+}
+
+// pointerEncoder encodes the value a pointer refers to. Nil pointers can only be written to nullable unions.
+func (c *compiler) pointerEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	enc, err := c.encoder(n, t.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(e *encoder, v reflect.Value) error {
+		if v.IsNil() {
+			return fmt.Errorf("nil %v cannot be encoded as avro %s", t, n.typeName())
+		}
+		return enc(e, v.Elem())
+	}, nil
+}
+
+func (c *compiler) pointerDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	dec, err := c.decoder(n, t.Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(d *decoder, v reflect.Value) error {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return dec(d, v.Elem())
+	}, nil
+}
+
+// structFields maps the avro field names declared in the struct tags of t to the index of the struct field
+func structFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("avro")
+		if name == "" || name == "-" || f.PkgPath != "" {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+// fieldEncoder writes a single record field, either from a struct field or from the pre-encoded schema default
+type fieldEncoder struct {
+	index  int
+	encode encodeFunc
+	def    []byte
+}
+
+func (c *compiler) recordEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	key := planKey{n, t}
+	if f, ok := c.encoders[key]; ok {
+		return func(e *encoder, v reflect.Value) error { return (*f)(e, v) }, nil
+	}
+
+	if err := checkFieldType(t); err != nil {
+		return nil, err
+	}
+
+	var f encodeFunc
+	c.encoders[key] = &f
+
+	indexes := structFields(t)
+	plan := make([]fieldEncoder, len(n.fields))
+	for i, field := range n.fields {
+		index, ok := indexes[field.name]
+		if !ok {
+			if !field.hasDefault {
+				return nil, ErrMissingField(field.name)
+			}
+			def := &encoder{}
+			if err := encodeDefault(def, field.typ, field.def); err != nil {
+				return nil, inField(err, "", field.name, nil, field.typ)
+			}
+			plan[i] = fieldEncoder{index: -1, def: def.buf}
+			continue
+		}
+
+		sf := t.Field(index)
+		enc, err := c.encoder(field.typ, sf.Type)
+		if err != nil {
+			return nil, inField(err, sf.Name, field.name, sf.Type, field.typ)
+		}
+		plan[i] = fieldEncoder{index: index, encode: enc}
+	}
+
+	encodeFields := func(e *encoder, v reflect.Value) error {
+		for i := range plan {
+			if plan[i].index < 0 {
+				e.buf = append(e.buf, plan[i].def...)
+				continue
+			}
+			if err := plan[i].encode(e, v.Field(plan[i].index)); err != nil {
+				field := t.Field(plan[i].index)
+				return inField(err, field.Name, n.fields[i].name, field.Type, n.fields[i].typ)
+			}
+		}
+		return nil
+	}
+
+	// values that refer to themselves would otherwise be encoded until the stack overflows
+	f = func(e *encoder, v reflect.Value) error {
+		if e.depth++; e.depth > maxDepth {
+			e.depth--
+			return ErrNestingTooDeep
+		}
+		err := encodeFields(e, v)
+		e.depth--
+		return err
+	}
+	return f, nil
+}
+
+// fieldDecoder reads a single record field into a struct field, or skips it if the struct has nowhere to put it
+type fieldDecoder struct {
+	index  int
+	decode decodeFunc
+	skip   *schemaNode
+}
+
+func (c *compiler) recordDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	key := planKey{n, t}
+	if f, ok := c.decoders[key]; ok {
+		return func(d *decoder, v reflect.Value) error { return (*f)(d, v) }, nil
+	}
+
+	if err := checkFieldType(t); err != nil {
+		return nil, err
+	}
+
+	var f decodeFunc
+	c.decoders[key] = &f
+
+	c.depth++
+	defer func() { c.depth-- }()
+
+	indexes := structFields(t)
+	plan := make([]fieldDecoder, len(n.fields))
+	for i, field := range n.fields {
+		index, ok := indexes[field.name]
+		if !ok {
+			plan[i] = fieldDecoder{index: -1, skip: field.typ}
+			continue
+		}
+
+		sf := t.Field(index)
+		dec, err := c.decoder(field.typ, sf.Type)
+		if err != nil {
+			return nil, inField(err, sf.Name, field.name, sf.Type, field.typ)
+		}
+		plan[i] = fieldDecoder{index: index, decode: dec}
+	}
+
+	return nestedDecoder(func(d *decoder, v reflect.Value) error {
+		for i := range plan {
+			if err := plan[i].read(d, v, t, n.fields[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, &f), nil
+}
+
+// read reads the field into the struct v of type t, or skips it, adding the location of the field to any error
+func (fd *fieldDecoder) read(d *decoder, v reflect.Value, t reflect.Type, field *schemaField) error {
+	if fd.index < 0 {
+		if err := skipValue(d, fd.skip); err != nil {
+			return inField(err, "", field.name, nil, field.typ)
+		}
+		return nil
+	}
+	if err := fd.decode(d, v.Field(fd.index)); err != nil {
+		sf := t.Field(fd.index)
+		return inField(err, sf.Name, field.name, sf.Type, field.typ)
+	}
+	return nil
+}
+
+// nestedDecoder sets f to a decoder of records, which limits how deeply they can be nested so that a payload cannot
+// recurse until the stack overflows, and returns it
+func nestedDecoder(decodeFields decodeFunc, f *decodeFunc) decodeFunc {
+	*f = func(d *decoder, v reflect.Value) error {
+		if d.depth++; d.depth > maxDepth {
+			d.depth--
+			return ErrNestingTooDeep
+		}
+		err := decodeFields(d, v)
+		d.depth--
+		return err
+	}
+	return *f
+}
+
+// isNillable reports whether values of kind k can be nil, and so be written as the null branch of a union
+func isNillable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+func (c *compiler) unionEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	nullIndex := n.nullIndex()
+
+	// Nil values are written as the null branch, anything else as the branch that best matches the Go type,
+	// regardless of where it appears in the union
+	branch := -1
+	var enc encodeFunc
+	var firstErr error
+	for _, i := range rankBranches(n, t) {
+		f, err := c.encoder(n.types[i], t)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		branch, enc = i, f
+		break
+	}
+
+	if firstErr == nil {
+		firstErr = ErrTypeMismatch(t, n.typeName())
+	}
+
+	// Values that match no branch can only be written as null, which needs a nullable union and a type that can be nil
+	nillable := isNillable(t.Kind())
+	if branch < 0 && (nullIndex < 0 || !nillable) {
+		return nil, firstErr
+	}
+
+	return func(e *encoder, v reflect.Value) error {
+		if nullIndex >= 0 && nillable && v.IsNil() {
+			e.writeLong(int64(nullIndex))
+			return nil
+		}
+		if branch < 0 {
+			return firstErr
+		}
+		e.writeLong(int64(branch))
+		return enc(e, v)
+	}, nil
+}
+
+// rankBranches returns the indexes of the non-null branches of a union that could hold the Go type t, best match first.
+// Branches that match equally well keep the order they have in the union.
+func rankBranches(n *schemaNode, t reflect.Type) []int {
+	var indexes, ranks []int
+	for i, typ := range n.types {
+		if r := branchRank(typ, t); r >= 0 {
+			indexes, ranks = append(indexes, i), append(ranks, r)
+		}
+	}
+	sort.Stable(byRank{indexes, ranks})
+	return indexes
+}
+
+type byRank struct {
+	indexes, ranks []int
+}
+
+func (b byRank) Len() int           { return len(b.indexes) }
+func (b byRank) Less(i, j int) bool { return b.ranks[i] < b.ranks[j] }
+func (b byRank) Swap(i, j int) {
+	b.indexes[i], b.indexes[j] = b.indexes[j], b.indexes[i]
+	b.ranks[i], b.ranks[j] = b.ranks[j], b.ranks[i]
+}
+
+// branchRank scores how well the schema n matches the Go type t, lower being better, or returns -1 if a value of
+// type t cannot be written as n
+func branchRank(n *schemaNode, t reflect.Type) int {
+	if t.Kind() == reflect.Ptr && t != ratPtrType {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		switch {
+		case n.logical == logicalTimestampMillis || n.logical == logicalTimestampMicros:
+			return 0
+		case n.logical == logicalLocalTimestampMillis || n.logical == logicalLocalTimestampMicros:
+			return 1
+		case n.logical == logicalDate:
+			return 2
+		case n.kind == kindString:
+			return 3
+		}
+		return -1
+	case durationType:
+		if durationUnit(n) != 0 {
+			return 0
+		}
+	case ratType, ratPtrType:
+		if n.logical == logicalDecimal {
+			return 0
+		}
+		return -1
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return rankKind(n, kindBoolean)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return rankKind(n, kindInt, kindLong, kindEnum)
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return rankKind(n, kindLong, kindInt, kindEnum)
+	case reflect.Float32:
+		return rankKind(n, kindFloat, kindDouble)
+	case reflect.Float64:
+		return rankKind(n, kindDouble, kindFloat)
+	case reflect.String:
+		return rankKind(n, kindString, kindEnum, kindBytes)
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return rankKind(n, kindFixed)
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return rankKind(n, kindBytes, kindFixed, kindArray)
+		}
+		return rankKind(n, kindArray)
+	case reflect.Map:
+		return rankKind(n, kindMap)
+	case reflect.Struct:
+		if n.kind != kindRecord {
+			return -1
+		}
+		if sameName(n.name, t.Name()) {
+			return 0
+		}
+		return 1
+	}
+	return -1
+}
+
+// rankKind returns the position of the kind of n in the list of kinds, or -1 if it is not listed
+func rankKind(n *schemaNode, kinds ...kind) int {
+	for i, k := range kinds {
+		if n.kind == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameName reports whether the unqualified name of a record matches the name of a Go type, ignoring case and the
+// separators commonly used in avro names
+func sameName(fullName, typeName string) bool {
+	name := fullName[strings.LastIndex(fullName, ".")+1:]
+	name = strings.NewReplacer("_", "", "-", "").Replace(name)
+	return typeName != "" && strings.EqualFold(name, typeName)
+}
+
+func (c *compiler) unionDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	decoders := make([]decodeFunc, len(n.types))
+	errs := make([]error, len(n.types))
+	compiled := false
+	for i, typ := range n.types {
+		if typ.kind == kindNull {
+			continue
+		}
+		decoders[i], errs[i] = c.decoder(typ, t)
+		if errs[i] == nil {
+			compiled = true
+		}
+	}
+
+	if !compiled && n.nullIndex() < 0 {
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrTypeMismatch(t, n.typeName())
+	}
+
+	zero := reflect.Zero(t)
+	return func(d *decoder, v reflect.Value) error {
+		index, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(n.types)) {
+			return fmt.Errorf("invalid union index %d", index)
+		}
+		if n.types[index].kind == kindNull {
+			v.Set(zero)
+			return nil
+		}
+		if decoders[index] == nil {
+			return errs[index]
+		}
+		return decoders[index](d, v)
+	}, nil
+}
+
+func (c *compiler) arrayEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	enc, err := c.encoder(n.items, t.Elem())
+	if err != nil {
+		return nil, inField(err, "[]", "[]", t.Elem(), n.items)
+	}
+
+	return func(e *encoder, v reflect.Value) error {
+		if l := v.Len(); l > 0 {
+			e.writeLong(int64(l))
+			for i := 0; i < l; i++ {
+				if err := enc(e, v.Index(i)); err != nil {
+					return inField(err, indexSegment(i), indexSegment(i), t.Elem(), n.items)
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+	}, nil
+}
+
+func (c *compiler) arrayDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	dec, err := c.decoder(n.items, t.Elem())
+	if err != nil {
+		return nil, inField(err, "[]", "[]", t.Elem(), n.items)
+	}
+	return arrayDecoder(t, n.items, dec), nil
+}
+
+// arrayDecoder reads an array of items into a slice of type t, decoding each item with dec
+func arrayDecoder(t reflect.Type, items *schemaNode, dec decodeFunc) decodeFunc {
+	zero := reflect.Zero(t.Elem())
+	return func(d *decoder, v reflect.Value) error {
+		count, err := d.readBlockCount()
+		if err != nil {
+			return err
+		}
+
+		s := reflect.MakeSlice(t, 0, d.capacity(count))
+		for count > 0 {
+			for i := 0; i < count; i++ {
+				s = reflect.Append(s, zero)
+				if err := dec(d, s.Index(s.Len()-1)); err != nil {
+					return inField(err, indexSegment(s.Len()-1), indexSegment(s.Len()-1), t.Elem(), items)
+				}
+			}
+			if count, err = d.readBlockCount(); err != nil {
+				return err
+			}
+		}
+
+		v.Set(s)
+		return nil
+	}
+}
+
+func (c *compiler) mapEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	if t.Key().Kind() != reflect.String {
+		return nil, ErrUnsupportedFieldType
+	}
+	enc, err := c.encoder(n.values, t.Elem())
+	if err != nil {
+		return nil, inField(err, "{}", "{}", t.Elem(), n.values)
+	}
+
+	return func(e *encoder, v reflect.Value) error {
+		if l := v.Len(); l > 0 {
+			// keys are sorted so that the same map always produces the same bytes
+			keys := v.MapKeys()
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+			e.writeLong(int64(l))
+			for _, key := range keys {
+				e.writeString(key.String())
+				if err := enc(e, v.MapIndex(key)); err != nil {
+					return inField(err, keySegment(key.String()), keySegment(key.String()), t.Elem(), n.values)
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+	}, nil
+}
+
+func (c *compiler) mapDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	if t.Key().Kind() != reflect.String {
+		return nil, ErrUnsupportedFieldType
+	}
+	dec, err := c.decoder(n.values, t.Elem())
+	if err != nil {
+		return nil, inField(err, "{}", "{}", t.Elem(), n.values)
+	}
+
+	// Empty maps in nested records have always been left nil by Unmarshal, whereas the fields of the message itself
+	// are always given a map
+	return mapDecoder(t, n.values, dec, c.depth > 1), nil
+}
+
+// mapDecoder reads a map of values into a map of type t, decoding each value with dec
+func mapDecoder(t reflect.Type, values *schemaNode, dec decodeFunc, nilWhenEmpty bool) decodeFunc {
+	keyType := t.Key()
+	zero := reflect.Zero(t.Elem())
+	return func(d *decoder, v reflect.Value) error {
+		count, err := d.readBlockCount()
+		if err != nil {
+			return err
+		}
+		if count == 0 && nilWhenEmpty {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+
+		m := reflect.MakeMapWithSize(t, d.capacity(count))
+		value := reflect.New(t.Elem()).Elem()
+		for count > 0 {
+			for i := 0; i < count; i++ {
+				key, err := d.readString()
+				if err != nil {
+					return err
+				}
+				value.Set(zero)
+				if err := dec(d, value); err != nil {
+					return inField(err, keySegment(key), keySegment(key), t.Elem(), values)
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(keyType), value)
+			}
+			if count, err = d.readBlockCount(); err != nil {
+				return err
+			}
+		}
+
+		v.Set(m)
+		return nil
+	}
+}
+
+// skipValue reads past a value of schema n without storing it anywhere
+func skipValue(d *decoder, n *schemaNode) error {
+	var err error
+	switch n.kind {
+	case kindNull:
+	case kindBoolean:
+		_, err = d.readByte()
+	case kindInt, kindLong, kindEnum:
+		_, err = d.readLong()
+	case kindFloat:
+		_, err = d.next(4)
+	case kindDouble:
+		_, err = d.next(8)
+	case kindBytes, kindString:
+		var l int
+		if l, err = d.readLength(); err == nil {
+			_, err = d.next(l)
+		}
+	case kindFixed:
+		_, err = d.next(n.size)
+	case kindRecord:
+		// recursive records are limited to the same depth as when they are decoded
+		if d.depth++; d.depth > maxDepth {
+			d.depth--
+			return ErrNestingTooDeep
+		}
+		for _, f := range n.fields {
+			if err = skipValue(d, f.typ); err != nil {
+				break
+			}
+		}
+		d.depth--
+	case kindArray, kindMap:
+		return skipBlocks(d, n)
+	case kindUnion:
+		var index int64
+		if index, err = d.readLong(); err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(n.types)) {
+			return fmt.Errorf("invalid union index %d", index)
+		}
+		return skipValue(d, n.types[index])
+	}
+	return err
+}
+
+func skipBlocks(d *decoder, n *schemaNode) error {
+	for {
+		count, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// negative counts are followed by the block size, so the whole block can be skipped at once
+			size, err := d.readLong()
+			if err != nil {
+				return err
+			}
+			if size < 0 || size > maxBlockLength {
+				return errInvalidLength
+			}
+			if _, err = d.next(int(size)); err != nil {
+				return err
+			}
+			continue
+		}
+		if count > maxBlockLength {
+			return errInvalidLength
+		}
+		for i := int64(0); i < count; i++ {
+			if n.kind == kindMap {
+				if _, err = d.readString(); err != nil {
+					return err
+				}
+				if err = skipValue(d, n.values); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = skipValue(d, n.items); err != nil {
+				return err
+			}
+		}
+	}
+}
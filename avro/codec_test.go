@@ -0,0 +1,574 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	goavro "github.com/go-avro/avro"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var benchmarkSchema = `{
+  "type": "record",
+  "name": "benchmark-event",
+  "fields": [
+    {"name": "created", "type": "string", "default": ""},
+    {"name": "service", "type": "string", "default": ""},
+    {"name": "request_id", "type": "string", "default": ""},
+    {"name": "user", "type": "string", "default": ""},
+    {"name": "attempted_action", "type": "string", "default": ""},
+    {"name": "action_result", "type": "string", "default": ""},
+    {"name": "params", "default": null, "type": ["null", {"type": "map", "values": "string"}]}
+  ]
+}`
+
+var recursiveSchema = `{
+  "type": "record",
+  "name": "node",
+  "fields": [
+    {"name": "name", "type": "string"},
+    {"name": "children", "type": {"type": "array", "items": "node"}}
+  ]
+}`
+
+type benchmarkEvent struct {
+	Created         string            `avro:"created"`
+	Service         string            `avro:"service"`
+	RequestID       string            `avro:"request_id"`
+	User            string            `avro:"user"`
+	AttemptedAction string            `avro:"attempted_action"`
+	ActionResult    string            `avro:"action_result"`
+	Params          map[string]string `avro:"params"`
+}
+
+type treeNode struct {
+	Name     string     `avro:"name"`
+	Children []treeNode `avro:"children"`
+}
+
+var benchmarkData = benchmarkEvent{
+	Created:         "2018-06-01 12:00:00.000000000 +0000 UTC",
+	Service:         "dataset-api",
+	RequestID:       "abcdefghijklmnop",
+	User:            "someone@ons.gov.uk",
+	AttemptedAction: "put_dataset",
+	ActionResult:    "successful",
+	Params:          map[string]string{"dataset_id": "cpih01", "edition": "time-series"},
+}
+
+// legacyMarshal encodes the benchmark event the way Marshal used to, parsing the schema and building a generic record
+// for every message.
+func legacyMarshal(definition string, data benchmarkEvent) ([]byte, error) {
+	schema, err := goavro.ParseSchema(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	record := goavro.NewGenericRecord(schema)
+	record.Set("created", data.Created)
+	record.Set("service", data.Service)
+	record.Set("request_id", data.RequestID)
+	record.Set("user", data.User)
+	record.Set("attempted_action", data.AttemptedAction)
+	record.Set("action_result", data.ActionResult)
+	record.Set("params", data.Params)
+
+	writer := goavro.NewGenericDatumWriter()
+	writer.SetSchema(schema)
+
+	buffer := new(bytes.Buffer)
+	if err = writer.Write(record, goavro.NewBinaryEncoder(buffer)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func TestUnitCodec(t *testing.T) {
+	Convey("Marshal produces the same bytes as the go-avro generic writer", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		data := benchmarkData
+		data.Params = map[string]string{"dataset_id": "cpih01"}
+
+		expected, err := legacyMarshal(benchmarkSchema, data)
+		So(err, ShouldBeNil)
+
+		actual, err := schema.Marshal(data)
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, expected)
+	})
+
+	Convey("The go-avro generic reader can read what Marshal writes", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		b, err := schema.Marshal(benchmarkData)
+		So(err, ShouldBeNil)
+
+		parsed, err := goavro.ParseSchema(benchmarkSchema)
+		So(err, ShouldBeNil)
+		reader := goavro.NewGenericDatumReader()
+		reader.SetSchema(parsed)
+		record := goavro.NewGenericRecord(parsed)
+		err = reader.Read(record, goavro.NewBinaryDecoder(b))
+		So(err, ShouldBeNil)
+		So(record.Get("user"), ShouldEqual, benchmarkData.User)
+		So(record.Get("params"), ShouldResemble, map[string]interface{}{"dataset_id": "cpih01", "edition": "time-series"})
+	})
+
+	Convey("The schema is parsed once and compiled once per Go type", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		_, err := schema.Marshal(benchmarkData)
+		So(err, ShouldBeNil)
+
+		c, err := schema.compiled()
+		So(err, ShouldBeNil)
+
+		_, err = schema.Marshal(&benchmarkData)
+		So(err, ShouldBeNil)
+		again, err := schema.compiled()
+		So(err, ShouldBeNil)
+		So(again, ShouldEqual, c)
+
+		count := 0
+		c.encoders.Range(func(k, v interface{}) bool {
+			count++
+			return true
+		})
+		So(count, ShouldEqual, 1)
+	})
+
+	Convey("The map encoding does not depend on iteration order", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		data := benchmarkData
+		data.Params = map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}
+
+		first, err := schema.Marshal(data)
+		So(err, ShouldBeNil)
+		for i := 0; i < 10; i++ {
+			b, err := schema.Marshal(data)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, first)
+		}
+	})
+
+	Convey("Recursive schemas can be marshalled and unmarshalled", t, func() {
+		schema := &Schema{Definition: recursiveSchema}
+		tree := treeNode{
+			Name: "root",
+			Children: []treeNode{
+				{Name: "left", Children: []treeNode{{Name: "leaf", Children: []treeNode{}}}},
+				{Name: "right", Children: []treeNode{}},
+			},
+		}
+
+		b, err := schema.Marshal(tree)
+		So(err, ShouldBeNil)
+
+		var actual treeNode
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, tree)
+	})
+
+	Convey("A schema can be used from many goroutines at once", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		expected, err := legacyMarshal(benchmarkSchema, benchmarkData)
+		So(err, ShouldBeNil)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b, err := schema.Marshal(benchmarkData)
+				if err != nil {
+					errs <- err
+					return
+				}
+				var actual benchmarkEvent
+				if err = schema.Unmarshal(b, &actual); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+
+		b, err := schema.Marshal(benchmarkData)
+		So(err, ShouldBeNil)
+		So(len(b), ShouldEqual, len(expected))
+	})
+
+	Convey("Defaults are written for schema fields missing from the struct", t, func() {
+		schema := &Schema{Definition: `{"type": "record", "name": "defaults", "fields": [
+			{"name": "name", "type": "string"},
+			{"name": "count", "type": "long", "default": 42},
+			{"name": "tags", "type": {"type": "array", "items": "string"}, "default": ["a", "b"]},
+			{"name": "labels", "type": ["null", "string"], "default": null},
+			{"name": "inner", "type": {"type": "record", "name": "inner", "fields": [
+				{"name": "flag", "type": "boolean", "default": true}
+			]}, "default": {}}
+		]}`}
+
+		type withoutDefaults struct {
+			Name string `avro:"name"`
+		}
+		type withEverything struct {
+			Name   string   `avro:"name"`
+			Count  int64    `avro:"count"`
+			Tags   []string `avro:"tags"`
+			Labels []string `avro:"-"`
+			Inner  struct {
+				Flag bool `avro:"flag"`
+			} `avro:"inner"`
+		}
+
+		b, err := schema.Marshal(withoutDefaults{Name: "x"})
+		So(err, ShouldBeNil)
+
+		var actual withEverything
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual.Name, ShouldEqual, "x")
+		So(actual.Count, ShouldEqual, 42)
+		So(actual.Tags, ShouldResemble, []string{"a", "b"})
+		So(actual.Inner.Flag, ShouldBeTrue)
+	})
+
+	Convey("An invalid default is reported when the struct has no value for the field", t, func() {
+		schema := &Schema{Definition: `{"type": "record", "name": "defaults", "fields": [
+			{"name": "count", "type": "int", "default": "forty two"}
+		]}`}
+
+		_, err := schema.Marshal(struct{}{})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestUnitParseSchema(t *testing.T) {
+	Convey("Named types can be referenced by their full name or from within their namespace", t, func() {
+		n, err := parseSchema(`{"type": "record", "name": "outer", "namespace": "ons.test", "fields": [
+			{"name": "a", "type": {"type": "fixed", "name": "md5", "size": 16}},
+			{"name": "b", "type": "md5"},
+			{"name": "c", "type": "ons.test.md5"}
+		]}`)
+		So(err, ShouldBeNil)
+		So(n.name, ShouldEqual, "ons.test.outer")
+		So(n.fields[1].typ, ShouldEqual, n.fields[0].typ)
+		So(n.fields[2].typ, ShouldEqual, n.fields[0].typ)
+		So(n.fields[0].typ.size, ShouldEqual, 16)
+	})
+
+	Convey("Invalid schemas return an error", t, func() {
+		for _, definition := range []string{
+			``,
+			`"unknown"`,
+			`[]`,
+			`{"type": "record", "fields": []}`,
+			`{"type": "record", "name": "x"}`,
+			`{"type": "record", "name": "x", "fields": [{"type": "string"}]}`,
+			`{"type": "record", "name": "x", "fields": [{"name": "a", "type": "string"}, {"name": "a", "type": "string"}]}`,
+			`{"type": "enum", "name": "x", "symbols": []}`,
+			`{"type": "fixed", "name": "x"}`,
+			`["null", ["string"]]`,
+		} {
+			_, err := parseSchema(definition)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	schema := &Schema{Definition: benchmarkSchema}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := schema.Marshal(&benchmarkData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLegacyMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := legacyMarshal(benchmarkSchema, benchmarkData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	schema := &Schema{Definition: benchmarkSchema}
+	message, err := schema.Marshal(&benchmarkData)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var event benchmarkEvent
+		if err := schema.Unmarshal(message, &event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalParallel(b *testing.B) {
+	schema := &Schema{Definition: benchmarkSchema}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := schema.Marshal(&benchmarkData); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+var primitivesSchema = `{
+  "type": "record",
+  "name": "primitives",
+  "fields": [
+    {"name": "ratio", "type": "float"},
+    {"name": "value", "type": "double"},
+    {"name": "count", "type": "int"},
+    {"name": "total", "type": "long"},
+    {"name": "small", "type": "int"},
+    {"name": "unsigned", "type": "long"},
+    {"name": "checksum", "type": "bytes"},
+    {"name": "hash", "type": {"type": "fixed", "name": "md5", "size": 4}},
+    {"name": "digest", "type": "md5"},
+    {"name": "state", "type": {"type": "enum", "name": "state", "symbols": ["created", "edition-confirmed", "published"]}},
+    {"name": "previous_state", "type": "state"},
+    {"name": "observations", "type": ["null", "long"]},
+    {"name": "note", "type": ["null", "string"], "default": null}
+  ]
+}`
+
+type primitives struct {
+	Ratio         float64 `avro:"ratio"`
+	Value         float64 `avro:"value"`
+	Count         int     `avro:"count"`
+	Total         int     `avro:"total"`
+	Small         int8    `avro:"small"`
+	Unsigned      uint32  `avro:"unsigned"`
+	Checksum      []byte  `avro:"checksum"`
+	Hash          [4]byte `avro:"hash"`
+	Digest        []byte  `avro:"digest"`
+	State         string  `avro:"state"`
+	PreviousState int     `avro:"previous_state"`
+	Observations  *int64  `avro:"observations"`
+	Note          *string `avro:"note"`
+}
+
+func TestUnitPrimitiveTypes(t *testing.T) {
+	schema := &Schema{Definition: primitivesSchema}
+	observations := int64(1234567890123)
+	note := "provisional"
+
+	Convey("All primitive types round trip", t, func() {
+		data := primitives{
+			Ratio:         0.5,
+			Value:         3.141592653589793,
+			Count:         -42,
+			Total:         1 << 40,
+			Small:         -8,
+			Unsigned:      4000000000,
+			Checksum:      []byte{0xde, 0xad, 0xbe, 0xef},
+			Hash:          [4]byte{1, 2, 3, 4},
+			Digest:        []byte{5, 6, 7, 8},
+			State:         "published",
+			PreviousState: 1,
+			Observations:  &observations,
+			Note:          &note,
+		}
+
+		b, err := schema.Marshal(&data)
+		So(err, ShouldBeNil)
+
+		var actual primitives
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, data)
+	})
+
+	Convey("Nil pointers are written as null and read back as nil", t, func() {
+		data := primitives{State: "created", Digest: make([]byte, 4)}
+		b, err := schema.Marshal(data)
+		So(err, ShouldBeNil)
+
+		actual := primitives{Observations: &observations, Note: &note}
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual.Observations, ShouldBeNil)
+		So(actual.Note, ShouldBeNil)
+	})
+
+	Convey("Values that do not fit the avro type return an error", t, func() {
+		_, err := schema.Marshal(primitives{Count: 1 << 40, State: "created", Digest: make([]byte, 4)})
+		So(err, ShouldNotBeNil)
+
+		_, err = schema.Marshal(primitives{State: "withdrawn", Digest: make([]byte, 4)})
+		So(err, ShouldNotBeNil)
+
+		_, err = schema.Marshal(primitives{State: "created", PreviousState: 3, Digest: make([]byte, 4)})
+		So(err, ShouldNotBeNil)
+
+		_, err = schema.Marshal(primitives{State: "created", Digest: make([]byte, 3)})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Values that do not fit the Go type return an error", t, func() {
+		type narrow struct {
+			Total int8 `avro:"total"`
+		}
+		s := &Schema{Definition: `{"type": "record", "name": "narrow", "fields": [{"name": "total", "type": "long"}]}`}
+		b, err := s.Marshal(struct {
+			Total int64 `avro:"total"`
+		}{Total: 300})
+		So(err, ShouldBeNil)
+
+		var actual narrow
+		So(s.Unmarshal(b, &actual), ShouldNotBeNil)
+	})
+
+	Convey("A nil pointer for a field that is not nullable returns an error", t, func() {
+		s := &Schema{Definition: `{"type": "record", "name": "r", "fields": [{"name": "total", "type": "long"}]}`}
+		_, err := s.Marshal(struct {
+			Total *int64 `avro:"total"`
+		}{})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+var collectionsSchema = `{
+  "type": "record",
+  "name": "dimension",
+  "fields": [
+    {"name": "codes", "type": {"type": "map", "values": {
+      "type": "record", "name": "code", "fields": [
+        {"name": "label", "type": "string"},
+        {"name": "children", "type": {"type": "array", "items": "code"}}
+      ]
+    }}},
+    {"name": "counts", "type": {"type": "array", "items": "int"}},
+    {"name": "flags", "type": {"type": "array", "items": "boolean"}},
+    {"name": "totals", "type": {"type": "array", "items": {"type": "map", "values": "long"}}},
+    {"name": "grid", "type": {"type": "array", "items": {"type": "array", "items": "double"}}},
+    {"name": "lookup", "type": {"type": "map", "values": {"type": "map", "values": {"type": "array", "items": "string"}}}}
+  ]
+}`
+
+type dimension struct {
+	Codes  map[string]code                `avro:"codes"`
+	Counts []int32                        `avro:"counts"`
+	Flags  []bool                         `avro:"flags"`
+	Totals []map[string]int64             `avro:"totals"`
+	Grid   [][]float64                    `avro:"grid"`
+	Lookup map[string]map[string][]string `avro:"lookup"`
+}
+
+type code struct {
+	Label    string `avro:"label"`
+	Children []code `avro:"children"`
+}
+
+func TestUnitCollections(t *testing.T) {
+	schema := &Schema{Definition: collectionsSchema}
+
+	Convey("Collections of any type round trip", t, func() {
+		data := dimension{
+			Codes: map[string]code{
+				"K02000001": {Label: "United Kingdom", Children: []code{
+					{Label: "England", Children: []code{{Label: "London", Children: []code{}}}},
+					{Label: "Wales", Children: []code{}},
+				}},
+			},
+			Counts: []int32{1, -2, 3},
+			Flags:  []bool{true, false},
+			Totals: []map[string]int64{{"a": 1}, {"b": 2, "c": 3}},
+			Grid:   [][]float64{{1.5, 2.5}, {}, {3.5}},
+			Lookup: map[string]map[string][]string{"time": {"2018": {"Q1", "Q2"}}},
+		}
+
+		b, err := schema.Marshal(data)
+		So(err, ShouldBeNil)
+
+		var actual dimension
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, data)
+	})
+
+	Convey("Unions are resolved by matching the Go type rather than by position", t, func() {
+		s := &Schema{Definition: `{"type": "record", "name": "observation", "fields": [
+			{"name": "value", "type": ["string", "null", "long", "double"]},
+			{"name": "count", "type": ["string", "int", "long", "null"]},
+			{"name": "area", "type": ["null",
+				{"type": "record", "name": "geography", "fields": [{"name": "id", "type": "long"}]},
+				{"type": "record", "name": "area", "fields": [{"name": "id", "type": "long"}]}
+			]}
+		]}`}
+
+		type area struct {
+			ID int64 `avro:"id"`
+		}
+		type observation struct {
+			Value *float64 `avro:"value"`
+			Count int64    `avro:"count"`
+			Area  *area    `avro:"area"`
+		}
+
+		value := 10.5
+		b, err := s.Marshal(observation{Value: &value, Count: 7, Area: &area{ID: 3}})
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, []byte{
+			6, 0, 0, 0, 0, 0, 0, 0x25, 0x40, // branch 3 (double), 10.5
+			4, 14, // branch 2 (long), 7
+			4, 6, // branch 2 (area), 3
+		})
+
+		var actual observation
+		err = s.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(*actual.Value, ShouldEqual, value)
+		So(actual.Count, ShouldEqual, 7)
+		So(actual.Area, ShouldResemble, &area{ID: 3})
+
+		Convey("and nil values use the null branch wherever it appears", func() {
+			b, err := s.Marshal(observation{})
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, []byte{2, 4, 0, 0})
+		})
+	})
+	Convey("Values that match no branch of a nullable union return an error rather than being written as null", t, func() {
+		s := &Schema{Definition: `{"type": "record", "name": "observation", "fields": [
+			{"name": "value", "type": ["null", "string"]}
+		]}`}
+
+		type count struct {
+			Value int `avro:"value"`
+		}
+		b, err := s.Marshal(count{Value: 7})
+		So(errors.Is(err, ErrIncompatibleType), ShouldBeTrue)
+		So(b, ShouldBeNil)
+
+		type pointer struct {
+			Value *int `avro:"value"`
+		}
+		b, err = s.Marshal(pointer{})
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, []byte{0})
+
+		value := 7
+		b, err = s.Marshal(pointer{Value: &value})
+		So(errors.Is(err, ErrIncompatibleType), ShouldBeTrue)
+		So(b, ShouldBeNil)
+	})
+}
@@ -0,0 +1,173 @@
+package avro
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compatibility describes which way round two versions of a schema can be used to read each other's data
+type Compatibility int
+
+// Compatibility levels. Full compatibility is both backward and forward compatibility.
+const (
+	// Backward compatible schemas can read data written with the previous version
+	Backward Compatibility = 1 << iota
+	// Forward compatible schemas write data that the previous version can read
+	Forward
+	// Full compatible schemas are both backward and forward compatible
+	Full = Backward | Forward
+
+	// Incompatible schemas cannot read data written with the other version
+	Incompatible Compatibility = 0
+)
+
+func (c Compatibility) String() string {
+	switch c {
+	case Incompatible:
+		return "incompatible"
+	case Backward:
+		return "backward"
+	case Forward:
+		return "forward"
+	case Full:
+		return "full"
+	}
+	return fmt.Sprintf("Compatibility(%d)", int(c))
+}
+
+// CompatibilityError lists the reasons a schema does not have the compatibility required of it
+type CompatibilityError struct {
+	Level   Compatibility
+	Reasons []string
+}
+
+func (e *CompatibilityError) Error() string {
+	return fmt.Sprintf("schemas are not %s compatible: %s", e.Level, strings.Join(e.Reasons, "; "))
+}
+
+// CheckCompatibility returns nil if next has the required level of compatibility with previous, or a
+// *CompatibilityError giving every reason it does not
+func CheckCompatibility(previous, next *Schema, level Compatibility) error {
+	p, err := previous.compiled()
+	if err != nil {
+		return err
+	}
+	n, err := next.compiled()
+	if err != nil {
+		return err
+	}
+
+	var reasons []string
+	if level&Backward != 0 {
+		reasons = append(reasons, readable(p.schema, n.schema)...)
+	}
+	if level&Forward != 0 {
+		reasons = append(reasons, readable(n.schema, p.schema)...)
+	}
+
+	if len(reasons) > 0 {
+		return &CompatibilityError{Level: level, Reasons: reasons}
+	}
+	return nil
+}
+
+// CompatibilityOf returns the compatibility of next with previous
+func CompatibilityOf(previous, next *Schema) (Compatibility, error) {
+	p, err := previous.compiled()
+	if err != nil {
+		return Incompatible, err
+	}
+	n, err := next.compiled()
+	if err != nil {
+		return Incompatible, err
+	}
+
+	level := Incompatible
+	if len(readable(p.schema, n.schema)) == 0 {
+		level |= Backward
+	}
+	if len(readable(n.schema, p.schema)) == 0 {
+		level |= Forward
+	}
+	return level, nil
+}
+
+// readable returns the reasons data written with schema w cannot be read with schema r, following the avro schema
+// resolution rules
+func readable(w, r *schemaNode) []string {
+	c := &compatibilityCheck{seen: make(map[[2]*schemaNode]bool)}
+	c.check("", w, r)
+	return c.reasons
+}
+
+type compatibilityCheck struct {
+	reasons []string
+	seen    map[[2]*schemaNode]bool
+}
+
+func (c *compatibilityCheck) add(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "<schema>"
+	}
+	c.reasons = append(c.reasons, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *compatibilityCheck) check(path string, w, r *schemaNode) {
+	if w.kind == kindUnion {
+		for _, branch := range w.types {
+			c.check(path, branch, r)
+		}
+		return
+	}
+
+	if r.kind == kindUnion {
+		for _, branch := range r.types {
+			if schemasMatch(w, branch) {
+				c.check(path, w, branch)
+				return
+			}
+		}
+		c.add(path, "%s is not in the reader's union", w.typeName())
+		return
+	}
+
+	if !schemasMatch(w, r) {
+		c.add(path, "%s cannot be read as %s", w.typeName(), r.typeName())
+		return
+	}
+
+	switch w.kind {
+	case kindRecord:
+		key := [2]*schemaNode{w, r}
+		if c.seen[key] {
+			return
+		}
+		c.seen[key] = true
+
+		read := make(map[*schemaField]bool, len(w.fields))
+		for _, wf := range w.fields {
+			if rf := readerField(r, wf.name); rf != nil {
+				read[rf] = true
+				c.check(joinPath(path, rf.name), wf.typ, rf.typ)
+			}
+		}
+		for _, rf := range r.fields {
+			if !read[rf] && !rf.hasDefault {
+				c.add(joinPath(path, rf.name), "the reader's field has no default and the writer doesn't have it")
+			}
+		}
+	case kindEnum:
+		if r.enumDefault != "" {
+			return
+		}
+		for _, symbol := range w.symbols {
+			if symbolIndex(r.symbols, symbol) < 0 {
+				c.add(path, "symbol %q is not in the reader's enum and it has no default", symbol)
+			}
+		}
+	case kindArray:
+		c.check(path+"[]", w.items, r.items)
+	case kindMap:
+		c.check(path+"{}", w.values, r.values)
+	}
+}
@@ -0,0 +1,338 @@
+package avro
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Codecs used to compress the blocks of an object container file
+const (
+	CodecNull    = "null"
+	CodecDeflate = "deflate"
+)
+
+const (
+	// containerBlockSize is the size of the encoded values at which a FileWriter writes a block
+	containerBlockSize = 64 * 1024
+	syncSize           = 16
+)
+
+var containerMagic = []byte{'O', 'b', 'j', 1}
+
+// ErrInvalidContainer is returned when reading a file that is not an avro object container file
+var ErrInvalidContainer = errors.New("not an avro object container file")
+
+// FileWriter writes values to an avro object container file, which holds the schema they were written with in its
+// header so that it can be read by any avro implementation. Values are buffered and written in compressed blocks,
+// so Close must be called once every value has been written.
+type FileWriter struct {
+	w      io.Writer
+	schema *Schema
+	codec  string
+	sync   [syncSize]byte
+
+	block      encoder
+	count      int
+	compressed bytes.Buffer
+	deflate    *flate.Writer
+	err        error
+}
+
+// NewFileWriter writes the header of an object container file for values of schema to w and returns a FileWriter for
+// its values. The codec must be CodecNull or CodecDeflate.
+func NewFileWriter(w io.Writer, schema *Schema, codec string) (*FileWriter, error) {
+	if codec != CodecNull && codec != CodecDeflate {
+		return nil, fmt.Errorf("unsupported avro codec %q", codec)
+	}
+	if _, err := schema.compiled(); err != nil {
+		return nil, err
+	}
+
+	fw := &FileWriter{w: w, schema: schema, codec: codec}
+	if _, err := rand.Read(fw.sync[:]); err != nil {
+		return nil, err
+	}
+
+	header := &encoder{buf: append([]byte(nil), containerMagic...)}
+	header.writeLong(2)
+	header.writeString("avro.schema")
+	header.writeString(schema.Definition)
+	header.writeString("avro.codec")
+	header.writeString(codec)
+	header.writeLong(0)
+	header.buf = append(header.buf, fw.sync[:]...)
+
+	if _, err := w.Write(header.buf); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// Write adds s to the file, writing a block if enough values have been buffered
+func (fw *FileWriter) Write(s interface{}) error {
+	if fw.err != nil {
+		return fw.err
+	}
+
+	size := len(fw.block.buf)
+	if err := fw.schema.encode(&fw.block, s); err != nil {
+		fw.block.buf = fw.block.buf[:size]
+		return err
+	}
+	fw.count++
+
+	if len(fw.block.buf) >= containerBlockSize {
+		return fw.Flush()
+	}
+	return nil
+}
+
+// Flush writes the buffered values as a block
+func (fw *FileWriter) Flush() error {
+	if fw.err != nil || fw.count == 0 {
+		return fw.err
+	}
+
+	data := fw.block.buf
+	if fw.codec == CodecDeflate {
+		fw.compressed.Reset()
+		if fw.deflate == nil {
+			fw.deflate, _ = flate.NewWriter(&fw.compressed, flate.DefaultCompression)
+		} else {
+			fw.deflate.Reset(&fw.compressed)
+		}
+		if _, err := fw.deflate.Write(data); err != nil {
+			fw.err = err
+			return err
+		}
+		if err := fw.deflate.Close(); err != nil {
+			fw.err = err
+			return err
+		}
+		data = fw.compressed.Bytes()
+	}
+
+	header := &encoder{}
+	header.writeLong(int64(fw.count))
+	header.writeLong(int64(len(data)))
+
+	for _, b := range [][]byte{header.buf, data, fw.sync[:]} {
+		if _, err := fw.w.Write(b); err != nil {
+			fw.err = err
+			return err
+		}
+	}
+
+	fw.block.buf = fw.block.buf[:0]
+	fw.count = 0
+	return nil
+}
+
+// Close writes any buffered values. It does not close the underlying writer.
+func (fw *FileWriter) Close() error {
+	return fw.Flush()
+}
+
+// FileReader reads the values of an avro object container file one at a time
+type FileReader struct {
+	r      *bufio.Reader
+	schema *Schema
+	reader *Schema
+	codec  string
+	sync   [syncSize]byte
+
+	block     decoder
+	remaining int
+	inflate   io.ReadCloser
+	err       error
+}
+
+// NewFileReader reads the header of the object container file in r and returns a FileReader for its values. If reader
+// is not nil values are resolved against it, as with Schema.UnmarshalFrom, otherwise they are read with the schema in
+// the file.
+func NewFileReader(r io.Reader, reader *Schema) (*FileReader, error) {
+	fr := &FileReader{r: bufio.NewReader(r), reader: reader}
+
+	magic := make([]byte, len(containerMagic))
+	if _, err := io.ReadFull(fr.r, magic); err != nil || !bytes.Equal(magic, containerMagic) {
+		return nil, ErrInvalidContainer
+	}
+
+	metadata, err := fr.readMetadata()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(fr.r, fr.sync[:]); err != nil {
+		return nil, ErrInvalidContainer
+	}
+
+	definition, ok := metadata["avro.schema"]
+	if !ok {
+		return nil, fmt.Errorf("%v: the header has no schema", ErrInvalidContainer)
+	}
+	fr.schema = &Schema{Definition: string(definition)}
+	if _, err := fr.schema.compiled(); err != nil {
+		return nil, err
+	}
+	if fr.reader == nil {
+		fr.reader = fr.schema
+	}
+
+	fr.codec = CodecNull
+	if codec, ok := metadata["avro.codec"]; ok {
+		fr.codec = string(codec)
+	}
+	if fr.codec != CodecNull && fr.codec != CodecDeflate {
+		return nil, fmt.Errorf("unsupported avro codec %q", fr.codec)
+	}
+
+	return fr, nil
+}
+
+// Schema returns the schema the values in the file were written with
+func (fr *FileReader) Schema() *Schema {
+	return fr.schema
+}
+
+// Read reads the next value from the file into the value pointed to by s. It returns io.EOF once every value has been
+// read. A value that cannot be read into s is skipped, so the next call reads the value after it.
+func (fr *FileReader) Read(s interface{}) error {
+	if fr.err != nil {
+		return fr.err
+	}
+
+	for fr.remaining == 0 {
+		if err := fr.readBlock(); err != nil {
+			fr.err = err
+			return err
+		}
+	}
+
+	pos := fr.block.pos
+	err := fr.reader.decode(&fr.block, fr.schema, s)
+	if err != nil {
+		// a value that could not be read is skipped so that the next Read moves on to the following value, or if it
+		// cannot be skipped either the rest of the block is, as the next value cannot be found within it
+		fr.block.pos = pos
+		if fr.skip() != nil {
+			fr.remaining = 0
+			return err
+		}
+	}
+	fr.remaining--
+	return err
+}
+
+// skip reads past the next value in the block
+func (fr *FileReader) skip() error {
+	c, err := fr.schema.compiled()
+	if err != nil {
+		return err
+	}
+	return skipValue(&fr.block, c.schema)
+}
+
+// readMetadata reads the map of metadata in the file header
+func (fr *FileReader) readMetadata() (map[string][]byte, error) {
+	metadata := make(map[string][]byte)
+	for {
+		count, err := fr.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return metadata, nil
+		}
+		if count < 0 {
+			count = -count
+			if _, err := fr.readLong(); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := int64(0); i < count; i++ {
+			key, err := fr.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			value, err := fr.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			metadata[string(key)] = value
+		}
+	}
+}
+
+// readBlock reads the next block of values, returning io.EOF at the end of the file
+func (fr *FileReader) readBlock() error {
+	// the end of the file can only come where a block would start
+	count, err := binary.ReadVarint(fr.r)
+	if err != nil {
+		return err
+	}
+
+	data, err := fr.readBytes()
+	if err != nil {
+		return err
+	}
+	if count < 0 || count > maxBlockLength {
+		return fmt.Errorf("%v: invalid block count %d", ErrInvalidContainer, count)
+	}
+
+	var sync [syncSize]byte
+	if _, err := io.ReadFull(fr.r, sync[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if sync != fr.sync {
+		return fmt.Errorf("%v: block does not end with the sync marker", ErrInvalidContainer)
+	}
+
+	if fr.codec == CodecDeflate {
+		if fr.inflate == nil {
+			fr.inflate = flate.NewReader(bytes.NewReader(data))
+		} else if err := fr.inflate.(flate.Resetter).Reset(bytes.NewReader(data), nil); err != nil {
+			return err
+		}
+		if data, err = io.ReadAll(io.LimitReader(fr.inflate, maxBlockLength+1)); err != nil {
+			return err
+		}
+		if len(data) > maxBlockLength {
+			return errInvalidLength
+		}
+	}
+
+	fr.block = decoder{buf: data}
+	fr.remaining = int(count)
+	return nil
+}
+
+func (fr *FileReader) readLong() (int64, error) {
+	i, err := binary.ReadVarint(fr.r)
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return i, err
+}
+
+func (fr *FileReader) readBytes() ([]byte, error) {
+	l, err := fr.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if l < 0 || l > maxBlockLength {
+		return nil, errInvalidLength
+	}
+
+	b := make([]byte, l)
+	if _, err := io.ReadFull(fr.r, b); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
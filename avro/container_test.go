@@ -0,0 +1,195 @@
+package avro
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	goavro "github.com/go-avro/avro"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeContainer writes count copies of the benchmark event, each with a different request id, to a container file
+func writeContainer(codec string, count int) ([]byte, error) {
+	var buf bytes.Buffer
+	fw, err := NewFileWriter(&buf, &Schema{Definition: benchmarkSchema}, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < count; i++ {
+		data := benchmarkData
+		data.RequestID = fmt.Sprintf("request-%d", i)
+		if err := fw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestUnitContainer(t *testing.T) {
+	for _, codec := range []string{CodecNull, CodecDeflate} {
+		Convey("Values round trip through a container file using the "+codec+" codec", t, func() {
+			// enough values to fill several blocks
+			b, err := writeContainer(codec, 2000)
+			So(err, ShouldBeNil)
+
+			fr, err := NewFileReader(bytes.NewReader(b), nil)
+			So(err, ShouldBeNil)
+			So(fr.Schema().Definition, ShouldEqual, benchmarkSchema)
+
+			for i := 0; i < 2000; i++ {
+				var actual benchmarkEvent
+				So(fr.Read(&actual), ShouldBeNil)
+				So(actual.RequestID, ShouldEqual, fmt.Sprintf("request-%d", i))
+				So(actual.Params, ShouldResemble, benchmarkData.Params)
+			}
+
+			var actual benchmarkEvent
+			So(fr.Read(&actual), ShouldEqual, io.EOF)
+			So(fr.Read(&actual), ShouldEqual, io.EOF)
+		})
+	}
+
+	Convey("Values are resolved against the reader schema when one is given", t, func() {
+		b, err := writeContainer(CodecDeflate, 1)
+		So(err, ShouldBeNil)
+
+		reader := &Schema{Definition: `{"type": "record", "name": "benchmark-event", "fields": [
+			{"name": "request_id", "type": "bytes"},
+			{"name": "region", "type": "string", "default": "uk"}
+		]}`}
+		fr, err := NewFileReader(bytes.NewReader(b), reader)
+		So(err, ShouldBeNil)
+
+		var actual struct {
+			RequestID []byte `avro:"request_id"`
+			Region    string `avro:"region"`
+		}
+		So(fr.Read(&actual), ShouldBeNil)
+		So(string(actual.RequestID), ShouldEqual, "request-0")
+		So(actual.Region, ShouldEqual, "uk")
+	})
+
+	Convey("Files written by the go-avro data file writer can be read", t, func() {
+		parsed, err := goavro.ParseSchema(benchmarkSchema)
+		So(err, ShouldBeNil)
+
+		var buf bytes.Buffer
+		writer := goavro.NewGenericDatumWriter()
+		dfw, err := goavro.NewDataFileWriter(&buf, parsed, writer)
+		So(err, ShouldBeNil)
+
+		record := goavro.NewGenericRecord(parsed)
+		record.Set("created", benchmarkData.Created)
+		record.Set("service", benchmarkData.Service)
+		record.Set("request_id", benchmarkData.RequestID)
+		record.Set("user", benchmarkData.User)
+		record.Set("attempted_action", benchmarkData.AttemptedAction)
+		record.Set("action_result", benchmarkData.ActionResult)
+		record.Set("params", benchmarkData.Params)
+		So(dfw.Write(record), ShouldBeNil)
+		So(dfw.Close(), ShouldBeNil)
+
+		fr, err := NewFileReader(&buf, &Schema{Definition: benchmarkSchema})
+		So(err, ShouldBeNil)
+
+		var actual benchmarkEvent
+		So(fr.Read(&actual), ShouldBeNil)
+		So(actual, ShouldResemble, benchmarkData)
+	})
+
+	Convey("Files can be read by the go-avro data file reader", t, func() {
+		b, err := writeContainer(CodecNull, 3)
+		So(err, ShouldBeNil)
+
+		path := filepath.Join(t.TempDir(), "events.avro")
+		So(os.WriteFile(path, b, 0600), ShouldBeNil)
+
+		dfr, err := goavro.NewDataFileReader(path)
+		So(err, ShouldBeNil)
+		defer dfr.Close()
+
+		for i := 0; i < 3; i++ {
+			So(dfr.HasNext(), ShouldBeTrue)
+			record := goavro.NewGenericRecord(nil)
+			So(dfr.Next(record), ShouldBeNil)
+			So(record.Get("request_id"), ShouldEqual, fmt.Sprintf("request-%d", i))
+		}
+		So(dfr.HasNext(), ShouldBeFalse)
+	})
+
+	Convey("Files that are not valid container files return an error", t, func() {
+		_, err := NewFileReader(bytes.NewReader([]byte("not avro")), nil)
+		So(err, ShouldEqual, ErrInvalidContainer)
+
+		b, err := writeContainer(CodecNull, 1)
+		So(err, ShouldBeNil)
+
+		Convey("including a block that doesn't end with the sync marker", func() {
+			corrupt := append([]byte(nil), b...)
+			corrupt[len(corrupt)-1]++
+
+			fr, err := NewFileReader(bytes.NewReader(corrupt), nil)
+			So(err, ShouldBeNil)
+
+			var actual benchmarkEvent
+			So(fr.Read(&actual), ShouldNotBeNil)
+		})
+
+		Convey("including a file that ends part way through a block", func() {
+			fr, err := NewFileReader(bytes.NewReader(b[:len(b)-20]), nil)
+			So(err, ShouldBeNil)
+
+			var actual benchmarkEvent
+			So(fr.Read(&actual), ShouldEqual, io.ErrUnexpectedEOF)
+		})
+	})
+
+	Convey("A value that cannot be read into the Go type given is skipped", t, func() {
+		b, err := writeContainer(CodecNull, 2)
+		So(err, ShouldBeNil)
+
+		fr, err := NewFileReader(bytes.NewReader(b), nil)
+		So(err, ShouldBeNil)
+
+		var mismatch struct {
+			User int `avro:"user"`
+		}
+		So(fr.Read(&mismatch), ShouldNotBeNil)
+
+		var actual benchmarkEvent
+		So(fr.Read(&actual), ShouldBeNil)
+		So(actual.RequestID, ShouldEqual, "request-1")
+		So(fr.Read(&actual), ShouldEqual, io.EOF)
+	})
+
+	Convey("Unsupported codecs return an error", t, func() {
+		_, err := NewFileWriter(&bytes.Buffer{}, &Schema{Definition: benchmarkSchema}, "snappy")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Values that cannot be marshalled are not added to the file", t, func() {
+		var buf bytes.Buffer
+		fw, err := NewFileWriter(&buf, &Schema{Definition: benchmarkSchema}, CodecNull)
+		So(err, ShouldBeNil)
+		So(fw.Write(struct {
+			User int `avro:"user"`
+		}{}), ShouldNotBeNil)
+		So(fw.Write(benchmarkData), ShouldBeNil)
+		So(fw.Close(), ShouldBeNil)
+
+		fr, err := NewFileReader(&buf, nil)
+		So(err, ShouldBeNil)
+
+		var actual benchmarkEvent
+		So(fr.Read(&actual), ShouldBeNil)
+		So(fr.Read(&actual), ShouldEqual, io.EOF)
+	})
+}
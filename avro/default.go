@@ -0,0 +1,204 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// encodeDefault writes the binary encoding of def, a field default taken from the JSON schema definition, using the
+// rules in the avro specification: union defaults use the first branch of the union and bytes or fixed defaults are
+// strings whose code points are the byte values.
+func encodeDefault(e *encoder, n *schemaNode, def interface{}) error {
+	return encodeJSONValue(e, n, def, false)
+}
+
+// encodeJSONValue writes the binary encoding of a value decoded from JSON. Field defaults and the avro JSON encoding
+// only differ in their unions: defaults are a value of the first branch, whereas in the JSON encoding a union value is
+// null or an object whose single key names the branch, and non-finite floating point numbers are strings.
+func encodeJSONValue(e *encoder, n *schemaNode, def interface{}, encoding bool) error {
+	invalid := func() error {
+		if encoding {
+			return fmt.Errorf("invalid JSON value %v for avro type %s", def, n.typeName())
+		}
+		return fmt.Errorf("invalid default value %v for avro type %s", def, n.typeName())
+	}
+
+	switch n.kind {
+	case kindNull:
+		if def != nil {
+			return invalid()
+		}
+	case kindBoolean:
+		b, ok := def.(bool)
+		if !ok {
+			return invalid()
+		}
+		e.writeBoolean(b)
+	case kindInt, kindLong:
+		num, ok := def.(json.Number)
+		if !ok {
+			return invalid()
+		}
+		i, err := num.Int64()
+		if err != nil || n.kind == kindInt && (i < math.MinInt32 || i > math.MaxInt32) {
+			return invalid()
+		}
+		e.writeLong(i)
+	case kindFloat, kindDouble:
+		var f float64
+		switch v := def.(type) {
+		case json.Number:
+			var err error
+			if f, err = v.Float64(); err != nil {
+				return invalid()
+			}
+		case string:
+			var ok bool
+			if f, ok = nonFinite[v]; !ok || !encoding {
+				return invalid()
+			}
+		default:
+			return invalid()
+		}
+		if n.kind == kindFloat {
+			e.writeFloat(float32(f))
+		} else {
+			e.writeDouble(f)
+		}
+	case kindString:
+		s, ok := def.(string)
+		if !ok {
+			return invalid()
+		}
+		e.writeString(s)
+	case kindBytes, kindFixed:
+		s, ok := def.(string)
+		if !ok {
+			return invalid()
+		}
+		b, ok := codePointBytes(s)
+		if !ok || n.kind == kindFixed && len(b) != n.size {
+			return invalid()
+		}
+		if n.kind == kindBytes {
+			e.writeBytes(b)
+		} else {
+			e.buf = append(e.buf, b...)
+		}
+	case kindEnum:
+		s, ok := def.(string)
+		if !ok {
+			return invalid()
+		}
+		index := symbolIndex(n.symbols, s)
+		if index < 0 {
+			return invalid()
+		}
+		e.writeLong(int64(index))
+	case kindArray:
+		items, ok := def.([]interface{})
+		if !ok {
+			return invalid()
+		}
+		if len(items) > 0 {
+			e.writeLong(int64(len(items)))
+			for _, item := range items {
+				if err := encodeJSONValue(e, n.items, item, encoding); err != nil {
+					return err
+				}
+			}
+		}
+		e.writeLong(0)
+	case kindMap:
+		values, ok := def.(map[string]interface{})
+		if !ok {
+			return invalid()
+		}
+		if len(values) > 0 {
+			e.writeLong(int64(len(values)))
+			for _, key := range sortedKeys(values) {
+				e.writeString(key)
+				if err := encodeJSONValue(e, n.values, values[key], encoding); err != nil {
+					return err
+				}
+			}
+		}
+		e.writeLong(0)
+	case kindRecord:
+		values, ok := def.(map[string]interface{})
+		if !ok {
+			return invalid()
+		}
+		for _, f := range n.fields {
+			// fields missing from the value take the default from the schema, which is always in the default form
+			value, ok := values[f.name]
+			valueEncoding := encoding
+			if !ok {
+				if !f.hasDefault {
+					return invalid()
+				}
+				value, valueEncoding = f.def, false
+			}
+			if err := encodeJSONValue(e, f.typ, value, valueEncoding); err != nil {
+				return err
+			}
+		}
+	case kindUnion:
+		if !encoding {
+			e.writeLong(0)
+			return encodeJSONValue(e, n.types[0], def, false)
+		}
+		if def == nil {
+			index := n.nullIndex()
+			if index < 0 {
+				return invalid()
+			}
+			e.writeLong(int64(index))
+			return nil
+		}
+		wrapped, ok := def.(map[string]interface{})
+		if !ok || len(wrapped) != 1 {
+			return invalid()
+		}
+		for i, branch := range n.types {
+			if value, ok := wrapped[branchName(branch)]; ok {
+				e.writeLong(int64(i))
+				return encodeJSONValue(e, branch, value, true)
+			}
+		}
+		return invalid()
+	}
+	return nil
+}
+
+// codePointBytes converts the JSON string form of a bytes value to the bytes it represents
+func codePointBytes(s string) ([]byte, bool) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, false
+		}
+		b = append(b, byte(r))
+	}
+	return b, true
+}
+
+func symbolIndex(symbols []string, symbol string) int {
+	for i, s := range symbols {
+		if s == symbol {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
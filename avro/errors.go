@@ -0,0 +1,97 @@
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Causes of a FieldError, for use with errors.Is
+var (
+	// ErrIncompatibleType is the cause of errors from using a Go type with an avro type it cannot be converted to
+	ErrIncompatibleType = errors.New("incompatible types")
+	// ErrNoDefault is the cause of errors from a struct having no value for a schema field that has no default
+	ErrNoDefault = errors.New("no value for the field and the schema has no default")
+	// ErrNestingTooDeep is returned for values nested more deeply than maxDepth, which can only be reached by
+	// recursive types: a Go value that refers to itself, or a malicious payload
+	ErrNestingTooDeep = errors.New("value is nested too deeply")
+)
+
+// maxDepth is the greatest number of records that can enclose a value being encoded or decoded
+const maxDepth = 1000
+
+// FieldError describes the field of a value that could not be marshalled or unmarshalled, and why
+type FieldError struct {
+	// Path is the location of the field in the Go value, such as Contacts[2].Name. Unknown indexes and map keys are
+	// given as [] and {} when the error comes from the types rather than a value.
+	Path string
+	// Field is the location of the field in the avro record, such as contacts[2].name
+	Field string
+	// GoType is the type of the Go field
+	GoType reflect.Type
+	// AvroType is the avro type of the field in the schema
+	AvroType string
+	// Err is the cause of the error
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	var where []string
+	if e.Field != "" {
+		where = append(where, "avro field "+e.Field)
+	}
+	if e.Path != "" && e.Path != e.Field {
+		where = append(where, "Go field "+e.Path)
+	}
+	if e.GoType != nil {
+		where = append(where, fmt.Sprintf("Go type %v", e.GoType))
+	}
+	if e.AvroType != "" {
+		where = append(where, "avro type "+e.AvroType)
+	}
+
+	if len(where) == 0 {
+		return e.Err.Error()
+	}
+	return strings.Join(where, ", ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// inField adds the location of a value within its parent to an error from encoding or decoding it. The segments are
+// a field name, or an index or key in brackets. Errors that are not already a FieldError come from the value itself,
+// so its Go and avro types are recorded with them.
+func inField(err error, goSegment, avroSegment string, t reflect.Type, n *schemaNode) error {
+	var fe FieldError
+	if e, ok := err.(*FieldError); ok {
+		fe = *e
+	} else {
+		fe = FieldError{Err: err, GoType: t, AvroType: n.typeName()}
+	}
+
+	fe.Path = joinSegment(goSegment, fe.Path)
+	fe.Field = joinSegment(avroSegment, fe.Field)
+	return &fe
+}
+
+func joinSegment(parent, child string) string {
+	switch {
+	case parent == "":
+		return child
+	case child == "" || child[0] == '[' || child[0] == '{':
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+func indexSegment(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+func keySegment(key string) string {
+	return fmt.Sprintf("[%q]", key)
+}
@@ -0,0 +1,179 @@
+package avro
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var releaseSchema = `{
+  "type": "record",
+  "name": "release",
+  "fields": [
+    {"name": "editions", "type": {"type": "array", "items": {
+      "type": "record", "name": "edition", "fields": [
+        {"name": "id", "type": "string"},
+        {"name": "downloads", "type": {"type": "map", "values": "int"}}
+      ]
+    }}}
+  ]
+}`
+
+type release struct {
+	Editions []edition `avro:"editions"`
+}
+
+type edition struct {
+	ID        string           `avro:"id"`
+	Downloads map[string]int64 `avro:"downloads"`
+}
+
+var linkSchema = `{
+  "type": "record",
+  "name": "link",
+  "fields": [
+    {"name": "name", "type": "string"},
+    {"name": "next", "type": ["null", "link"]}
+  ]
+}`
+
+type link struct {
+	Name string `avro:"name"`
+	Next *link  `avro:"next"`
+}
+
+// linkPayload returns the encoding of a chain of n links
+func linkPayload(n int) []byte {
+	b := make([]byte, 0, 2*n+2)
+	for i := 0; i < n; i++ {
+		b = append(b, 0, 2)
+	}
+	return append(b, 0, 0)
+}
+
+func TestUnitFieldErrors(t *testing.T) {
+	schema := &Schema{Definition: releaseSchema}
+
+	Convey("Errors from values give the path to the field in Go and in avro", t, func() {
+		data := release{Editions: []edition{
+			{ID: "2017", Downloads: map[string]int64{"csv": 10}},
+			{ID: "2018", Downloads: map[string]int64{"csv": 1 << 40}},
+		}}
+
+		_, err := schema.Marshal(data)
+		var fieldErr *FieldError
+		So(errors.As(err, &fieldErr), ShouldBeTrue)
+		So(fieldErr.Path, ShouldEqual, `Editions[1].Downloads["csv"]`)
+		So(fieldErr.Field, ShouldEqual, `editions[1].downloads["csv"]`)
+		So(fieldErr.GoType, ShouldEqual, reflect.TypeOf(int64(0)))
+		So(fieldErr.AvroType, ShouldEqual, "int")
+		So(err.Error(), ShouldStartWith, `avro field editions[1].downloads["csv"], Go field Editions[1].Downloads["csv"]`)
+	})
+
+	Convey("Errors from types give the path to the field without indexes or keys", t, func() {
+		type badEdition struct {
+			ID int `avro:"id"`
+		}
+		type badRelease struct {
+			Editions []badEdition `avro:"editions"`
+		}
+
+		_, err := schema.Marshal(badRelease{})
+		So(errors.Is(err, ErrIncompatibleType), ShouldBeTrue)
+
+		var fieldErr *FieldError
+		So(errors.As(err, &fieldErr), ShouldBeTrue)
+		So(fieldErr.Path, ShouldEqual, "Editions[].ID")
+		So(fieldErr.Field, ShouldEqual, "editions[].id")
+		So(fieldErr.GoType, ShouldEqual, reflect.TypeOf(0))
+		So(fieldErr.AvroType, ShouldEqual, "string")
+
+		var actual badRelease
+		err = schema.Unmarshal([]byte{0}, &actual)
+		So(errors.Is(err, ErrIncompatibleType), ShouldBeTrue)
+	})
+
+	Convey("Fields without a value or a default are named", t, func() {
+		type noDownloads struct {
+			ID string `avro:"id"`
+		}
+		type partialRelease struct {
+			Editions []noDownloads `avro:"editions"`
+		}
+
+		_, err := schema.Marshal(partialRelease{})
+		So(errors.Is(err, ErrNoDefault), ShouldBeTrue)
+
+		var fieldErr *FieldError
+		So(errors.As(err, &fieldErr), ShouldBeTrue)
+		So(fieldErr.Field, ShouldEqual, "editions[].downloads")
+	})
+
+	Convey("Malformed payloads give the field that could not be read", t, func() {
+		data := release{Editions: []edition{{ID: "2017", Downloads: map[string]int64{"csv": 10, "xls": 2}}}}
+		b, err := schema.Marshal(data)
+		So(err, ShouldBeNil)
+
+		var actual release
+		err = schema.Unmarshal(b[:len(b)-3], &actual)
+		So(errors.Is(err, io.ErrUnexpectedEOF), ShouldBeTrue)
+
+		var fieldErr *FieldError
+		So(errors.As(err, &fieldErr), ShouldBeTrue)
+		So(fieldErr.Field, ShouldEqual, `editions[0].downloads["xls"]`)
+	})
+
+	Convey("Errors resolving schemas give the path to the field", t, func() {
+		type renamedEdition struct {
+			ID        string            `avro:"id"`
+			Downloads map[string]string `avro:"downloads"`
+		}
+		type renamedRelease struct {
+			Editions []renamedEdition `avro:"editions"`
+		}
+		reader := &Schema{Definition: `{"type": "record", "name": "release", "fields": [
+			{"name": "editions", "type": {"type": "array", "items": {
+				"type": "record", "name": "edition", "fields": [
+					{"name": "id", "type": "string"},
+					{"name": "downloads", "type": {"type": "map", "values": "string"}}
+				]
+			}}}
+		]}`}
+
+		var actual renamedRelease
+		err := reader.UnmarshalFrom(schema, []byte{0}, &actual)
+
+		var fieldErr *FieldError
+		So(errors.As(err, &fieldErr), ShouldBeTrue)
+		So(fieldErr.Field, ShouldEqual, "editions[].downloads{}")
+	})
+
+	Convey("Values nested too deeply return an error rather than overflowing the stack", t, func() {
+		s := &Schema{Definition: linkSchema}
+
+		cycle := &link{Name: "cpih01"}
+		cycle.Next = cycle
+		_, err := s.Marshal(cycle)
+		So(errors.Is(err, ErrNestingTooDeep), ShouldBeTrue)
+
+		var actual link
+		So(s.Unmarshal(linkPayload(maxDepth-1), &actual), ShouldBeNil)
+		So(actual.Next, ShouldNotBeNil)
+
+		err = s.Unmarshal(linkPayload(maxDepth*10), &actual)
+		So(errors.Is(err, ErrNestingTooDeep), ShouldBeTrue)
+
+		Convey("including values skipped because the struct has no field for them", func() {
+			var name struct {
+				Name string `avro:"name"`
+			}
+			So(s.Unmarshal(linkPayload(maxDepth-1), &name), ShouldBeNil)
+
+			err = s.Unmarshal(linkPayload(maxDepth*10), &name)
+			So(errors.Is(err, ErrNestingTooDeep), ShouldBeTrue)
+		})
+	})
+}
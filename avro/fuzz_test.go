@@ -0,0 +1,57 @@
+package avro
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fuzzTargets are the schemas and Go types that arbitrary payloads are unmarshalled into
+var fuzzTargets = []struct {
+	schema *Schema
+	typ    reflect.Type
+}{
+	{&Schema{Definition: benchmarkSchema}, reflect.TypeOf(benchmarkEvent{})},
+	{&Schema{Definition: primitivesSchema}, reflect.TypeOf(primitives{})},
+	{&Schema{Definition: logicalSchema}, reflect.TypeOf(datasetRelease{})},
+	{&Schema{Definition: collectionsSchema}, reflect.TypeOf(dimension{})},
+	{&Schema{Definition: recursiveSchema}, reflect.TypeOf(treeNode{})},
+	{&Schema{Definition: linkSchema}, reflect.TypeOf(link{})},
+}
+
+// FuzzUnmarshal checks that malformed payloads return an error rather than panic, and that anything that can be read
+// can be written again
+func FuzzUnmarshal(f *testing.F) {
+	seeds := []interface{}{
+		benchmarkData,
+		primitives{Checksum: []byte{1, 2}, Digest: []byte{1, 2, 3, 4}, State: "published", Note: new(string)},
+		dimension{Codes: map[string]code{"K02000001": {Label: "United Kingdom", Children: []code{{Label: "Wales"}}}}},
+		treeNode{Name: "root", Children: []treeNode{{Name: "leaf"}}},
+		link{Name: "cpih01", Next: &link{Name: "cpi"}},
+	}
+	for _, seed := range seeds {
+		for _, target := range fuzzTargets {
+			if target.typ != reflect.TypeOf(seed) {
+				continue
+			}
+			b, err := target.schema.Marshal(seed)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(b)
+		}
+	}
+	f.Add(linkPayload(maxDepth + 1))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		for _, target := range fuzzTargets {
+			v := reflect.New(target.typ)
+			if err := target.schema.Unmarshal(payload, v.Interface()); err != nil {
+				continue
+			}
+			if _, err := target.schema.Marshal(v.Interface()); err != nil {
+				t.Errorf("unmarshalled %v from %x but could not marshal it: %v", target.typ, payload, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,300 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Struct tags read by Generate in addition to the avro field name tag. The default is a JSON value, as it would appear
+// in a hand-written schema.
+const (
+	docTag     = "avrodoc"
+	defaultTag = "avrodefault"
+)
+
+// Generate derives an avro record schema called name from the struct type of v and its avro tags, so that the schema
+// cannot fall out of step with the struct it is used with.
+//
+// Nested structs become records named after their Go type, pointers, maps and slices become unions with null that
+// default to null, and time.Time fields become timestamp-millis longs. The avrodoc and avrodefault tags set the doc
+// and default of a field.
+func Generate(name string, v interface{}) (*Schema, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrUnsupportedType(reflect.ValueOf(v).Kind())
+	}
+
+	g := &generator{defined: make(map[reflect.Type]string)}
+	record, err := g.record(name, t)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// parsing the result catches clashing record names, and defaults are checked against the types they are used with
+	n, err := parseSchema(string(b))
+	if err != nil {
+		return nil, err
+	}
+	if err = checkDefaults(n, make(map[*schemaNode]bool)); err != nil {
+		return nil, err
+	}
+
+	return &Schema{Definition: string(b)}, nil
+}
+
+// generator builds the JSON form of a schema, remembering the records already defined so that later uses of the same
+// struct type, including recursive ones, refer to the record by name
+type generator struct {
+	defined map[reflect.Type]string
+}
+
+func (g *generator) record(name string, t reflect.Type) (interface{}, error) {
+	g.defined[t] = name
+
+	fields := []interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldName := f.Tag.Get("avro")
+		if fieldName == "" || fieldName == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		typ, err := g.typeOf(f.Type, fieldName)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", fieldName, err)
+		}
+
+		field := map[string]interface{}{"name": fieldName, "type": typ}
+		if doc, ok := f.Tag.Lookup(docTag); ok {
+			field["doc"] = doc
+		}
+
+		if raw, ok := f.Tag.Lookup(defaultTag); ok {
+			var def interface{}
+			if err := json.Unmarshal([]byte(raw), &def); err != nil {
+				return nil, fmt.Errorf("field %q: invalid default %s: %v", fieldName, raw, err)
+			}
+			// a union default must be a value of the first branch, so non-null defaults move null to the end
+			if union, ok := typ.([]interface{}); ok && def != nil {
+				field["type"] = []interface{}{union[1], union[0]}
+			}
+			field["default"] = def
+		} else if _, ok := typ.([]interface{}); ok {
+			field["default"] = nil
+		}
+
+		fields = append(fields, field)
+	}
+
+	return map[string]interface{}{"type": "record", "name": name, "fields": fields}, nil
+}
+
+// typeOf returns the JSON form of the avro type for Go type t. The name is used for anonymous types that need one.
+func (g *generator) typeOf(t reflect.Type, name string) (interface{}, error) {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "long", "logicalType": logicalTimestampMillis}, nil
+	case ratType, ratPtrType:
+		return nil, fmt.Errorf("the precision and scale of %v cannot be derived from its type", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		typ, err := g.typeOf(t.Elem(), name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := typ.([]interface{}); ok {
+			return typ, nil
+		}
+		return []interface{}{"null", typ}, nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return "int", nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return "long", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	case reflect.String:
+		return "string", nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "fixed", "name": generatedName(t, name), "size": t.Len()}, nil
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes", nil
+		}
+		items, err := g.typeOf(t.Elem(), name)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{"null", map[string]interface{}{"type": "array", "items": items}}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, ErrUnsupportedFieldType
+		}
+		values, err := g.typeOf(t.Elem(), name)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{"null", map[string]interface{}{"type": "map", "values": values}}, nil
+	case reflect.Struct:
+		if defined, ok := g.defined[t]; ok {
+			return defined, nil
+		}
+		return g.record(generatedName(t, name), t)
+	}
+
+	return nil, ErrUnsupportedFieldType
+}
+
+// generatedName returns the name of a generated named type: the Go type name, or the field name for anonymous types
+func generatedName(t reflect.Type, field string) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return field
+}
+
+// checkDefaults returns an error if any record field default in the schema is not valid for the field type
+func checkDefaults(n *schemaNode, checked map[*schemaNode]bool) error {
+	if checked[n] {
+		return nil
+	}
+	checked[n] = true
+
+	switch n.kind {
+	case kindRecord:
+		for _, f := range n.fields {
+			if f.hasDefault {
+				if err := encodeDefault(&encoder{}, f.typ, f.def); err != nil {
+					return fmt.Errorf("field %q: %v", f.name, err)
+				}
+			}
+			if err := checkDefaults(f.typ, checked); err != nil {
+				return err
+			}
+		}
+	case kindArray:
+		return checkDefaults(n.items, checked)
+	case kindMap:
+		return checkDefaults(n.values, checked)
+	case kindUnion:
+		for _, typ := range n.types {
+			if err := checkDefaults(typ, checked); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Drift compares the schema with the struct type of v and describes each difference that would stop values of the
+// type being marshalled or unmarshalled faithfully: fields that only one of them has, and fields whose Go type cannot
+// be used with the avro type. An empty result means the two agree.
+func (schema *Schema) Drift(v interface{}) ([]string, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrUnsupportedType(reflect.ValueOf(v).Kind())
+	}
+
+	c, err := schema.compiled()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &drift{seen: make(map[planKey]bool)}
+	d.compare("", c.schema, t)
+	return d.differences, nil
+}
+
+type drift struct {
+	differences []string
+	seen        map[planKey]bool
+}
+
+func (d *drift) add(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "<record>"
+	}
+	d.differences = append(d.differences, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (d *drift) compare(path string, n *schemaNode, t reflect.Type) {
+	if n.kind == kindUnion {
+		branches := rankBranches(n, t)
+		if len(branches) == 0 {
+			d.add(path, "%v", ErrTypeMismatch(t, n.typeName()))
+			return
+		}
+		n = n.types[branches[0]]
+	}
+
+	if t.Kind() == reflect.Ptr && t != ratPtrType {
+		d.compare(path, n, t.Elem())
+		return
+	}
+
+	switch {
+	case n.kind == kindRecord && t.Kind() == reflect.Struct && t != timeType && t != ratType:
+		key := planKey{n, t}
+		if d.seen[key] {
+			return
+		}
+		d.seen[key] = true
+
+		indexes := structFields(t)
+		for _, f := range n.fields {
+			index, ok := indexes[f.name]
+			if !ok {
+				d.add(joinPath(path, f.name), "in the schema but not in %v", t)
+				continue
+			}
+			d.compare(joinPath(path, f.name), f.typ, t.Field(index).Type)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if name := f.Tag.Get("avro"); name != "" && name != "-" && f.PkgPath == "" && n.field(name) == nil {
+				d.add(joinPath(path, name), "in %v but not in the schema", t)
+			}
+		}
+	case n.kind == kindArray && t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		d.compare(path+"[]", n.items, t.Elem())
+	case n.kind == kindMap && t.Kind() == reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			d.add(path, "map keys of type %v cannot be used with avro maps", t.Key())
+			return
+		}
+		d.compare(path+"{}", n.values, t.Elem())
+	default:
+		if _, err := newCompiler().encoder(n, t); err != nil {
+			d.add(path, "%v", err)
+		} else if _, err := newCompiler().decoder(n, t); err != nil {
+			d.add(path, "%v", err)
+		}
+	}
+}
+
+// joinPath appends a field name to the path of the record containing it
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
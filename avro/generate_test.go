@@ -0,0 +1,175 @@
+package avro
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type generatedRelease struct {
+	ID        string            `avro:"id" avrodoc:"the release identifier"`
+	Edition   string            `avro:"edition" avrodefault:"\"time-series\""`
+	Version   int32             `avro:"version"`
+	Published time.Time         `avro:"published"`
+	Revision  *int64            `avro:"revision"`
+	Links     map[string]string `avro:"links"`
+	Latest    *generatedRelease `avro:"latest"`
+	Contacts  []contact         `avro:"contacts" avrodefault:"[]"`
+	Checksum  [4]byte           `avro:"checksum"`
+	internal  string
+	Ignored   string `avro:"-"`
+}
+
+type contact struct {
+	Name  string `avro:"name"`
+	Email string `avro:"email"`
+}
+
+func TestUnitGenerate(t *testing.T) {
+	Convey("A schema is generated from the avro tags of a struct", t, func() {
+		schema, err := Generate("release", generatedRelease{})
+		So(err, ShouldBeNil)
+
+		n, err := parseSchema(schema.Definition)
+		So(err, ShouldBeNil)
+		So(n.name, ShouldEqual, "release")
+		So(n.fields, ShouldHaveLength, 9)
+
+		So(n.field("id").typ.kind, ShouldEqual, kindString)
+		So(n.field("id").doc, ShouldEqual, "the release identifier")
+		So(n.field("id").hasDefault, ShouldBeFalse)
+		So(n.field("edition").def, ShouldEqual, "time-series")
+		So(n.field("version").typ.kind, ShouldEqual, kindInt)
+		So(n.field("published").typ.logical, ShouldEqual, logicalTimestampMillis)
+		So(n.field("checksum").typ.kind, ShouldEqual, kindFixed)
+		So(n.field("checksum").typ.size, ShouldEqual, 4)
+
+		Convey("with nillable fields as unions with null that default to null", func() {
+			for _, name := range []string{"revision", "links", "latest"} {
+				f := n.field(name)
+				So(f.typ.kind, ShouldEqual, kindUnion)
+				So(f.typ.types[0].kind, ShouldEqual, kindNull)
+				So(f.hasDefault, ShouldBeTrue)
+				So(f.def, ShouldBeNil)
+			}
+		})
+
+		Convey("with null moved last when a nillable field has another default", func() {
+			f := n.field("contacts")
+			So(f.typ.types[0].kind, ShouldEqual, kindArray)
+			So(f.typ.types[0].items.name, ShouldEqual, "contact")
+			So(f.typ.types[1].kind, ShouldEqual, kindNull)
+		})
+
+		Convey("with recursive types referring to the record by name", func() {
+			So(n.field("latest").typ.types[1], ShouldEqual, n)
+		})
+
+		Convey("that can be used with the struct", func() {
+			revision := int64(3)
+			data := generatedRelease{
+				ID:        "cpih01",
+				Edition:   "time-series",
+				Version:   2,
+				Published: time.Date(2018, time.June, 14, 9, 30, 0, 0, time.UTC),
+				Revision:  &revision,
+				Latest:    &generatedRelease{ID: "cpih01", Version: 3, Contacts: []contact{}},
+				Contacts:  []contact{{Name: "Bob", Email: "bob@example.com"}},
+				Checksum:  [4]byte{1, 2, 3, 4},
+			}
+
+			b, err := schema.Marshal(data)
+			So(err, ShouldBeNil)
+
+			var actual generatedRelease
+			So(schema.Unmarshal(b, &actual), ShouldBeNil)
+			So(actual, ShouldResemble, data)
+
+			drift, err := schema.Drift(generatedRelease{})
+			So(err, ShouldBeNil)
+			So(drift, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Types that have no avro equivalent return an error", t, func() {
+		_, err := Generate("r", struct {
+			Callback func() `avro:"callback"`
+		}{})
+		So(err, ShouldNotBeNil)
+
+		_, err = Generate("r", struct {
+			Counts map[int]string `avro:"counts"`
+		}{})
+		So(err, ShouldNotBeNil)
+
+		_, err = Generate("r", "not a struct")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Invalid defaults return an error", t, func() {
+		_, err := Generate("r", struct {
+			Count int64 `avro:"count" avrodefault:"\"none\""`
+		}{})
+		So(err, ShouldNotBeNil)
+
+		_, err = Generate("r", struct {
+			Count int64 `avro:"count" avrodefault:"{"`
+		}{})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestUnitDrift(t *testing.T) {
+	schema := &Schema{Definition: `{"type": "record", "name": "release", "fields": [
+		{"name": "id", "type": "string"},
+		{"name": "version", "type": "int"},
+		{"name": "removed", "type": "string", "default": ""},
+		{"name": "contacts", "type": {"type": "array", "items": {"type": "record", "name": "contact", "fields": [
+			{"name": "name", "type": "string"},
+			{"name": "phone", "type": "long"}
+		]}}}
+	]}`}
+
+	Convey("Differences between a schema and a struct are reported by field", t, func() {
+		type driftedContact struct {
+			Name  string `avro:"name"`
+			Phone string `avro:"phone"`
+		}
+		drift, err := schema.Drift(struct {
+			ID       string           `avro:"id"`
+			Version  bool             `avro:"version"`
+			Added    string           `avro:"added"`
+			Contacts []driftedContact `avro:"contacts"`
+		}{})
+		So(err, ShouldBeNil)
+		So(drift, ShouldHaveLength, 4)
+		So(drift[0], ShouldStartWith, "version: ")
+		So(drift[1], ShouldStartWith, "removed: in the schema")
+		So(drift[2], ShouldStartWith, "contacts[].phone: ")
+		So(drift[3], ShouldStartWith, "added: in ")
+	})
+
+	Convey("A struct that matches the schema has no drift", t, func() {
+		type phoneContact struct {
+			Name  string `avro:"name"`
+			Phone int64  `avro:"phone"`
+		}
+		drift, err := schema.Drift(&struct {
+			ID       string         `avro:"id"`
+			Version  int            `avro:"version"`
+			Removed  string         `avro:"removed"`
+			Contacts []phoneContact `avro:"contacts"`
+		}{})
+		So(err, ShouldBeNil)
+		So(drift, ShouldBeEmpty)
+	})
+
+	Convey("Drift returns an error for invalid schemas and values that are not structs", t, func() {
+		_, err := (&Schema{Definition: "{"}).Drift(contact{})
+		So(err, ShouldNotBeNil)
+
+		_, err = schema.Drift(1)
+		So(err, ShouldNotBeNil)
+	})
+}
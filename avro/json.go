@@ -0,0 +1,244 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// nonFinite maps the strings used for floating point numbers JSON cannot represent to their values
+var nonFinite = map[string]float64{
+	"NaN":       math.NaN(),
+	"Infinity":  math.Inf(1),
+	"-Infinity": math.Inf(-1),
+}
+
+// EncodeJSON returns the avro JSON encoding of s, in which union values are null or an object whose single key is
+// the name of the branch holding the value, for example {"string": "cpih01"}, and bytes and fixed values are strings
+// whose code points are the byte values. It is meant for people rather than programs: logs, fixtures and tools.
+func (schema *Schema) EncodeJSON(s interface{}) ([]byte, error) {
+	e := encoderPool.Get().(*encoder)
+	defer releaseEncoder(e)
+
+	if err := schema.encode(e, s); err != nil {
+		return nil, err
+	}
+
+	c, err := schema.compiled()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = writeJSON(&buf, &decoder{buf: e.buf}, c.schema); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeJSON parses the avro JSON encoding of a value and stores the result in the value pointed to by s
+func (schema *Schema) DecodeJSON(data []byte, s interface{}) error {
+	c, err := schema.compiled()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err = dec.Decode(&value); err != nil {
+		return err
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		return errors.New("invalid JSON: unexpected data after the value")
+	}
+
+	e := encoderPool.Get().(*encoder)
+	defer releaseEncoder(e)
+
+	if err = encodeJSONValue(e, c.schema, value, true); err != nil {
+		return err
+	}
+	return schema.decode(&decoder{buf: e.buf}, nil, s)
+}
+
+// branchName returns the name that identifies a union branch in the JSON encoding
+func branchName(n *schemaNode) string {
+	if n.isNamed() {
+		return n.name
+	}
+	return n.kind.String()
+}
+
+// writeJSON reads a binary encoded value of schema n and writes its JSON encoding to buf
+func writeJSON(buf *bytes.Buffer, d *decoder, n *schemaNode) error {
+	switch n.kind {
+	case kindNull:
+		buf.WriteString("null")
+	case kindBoolean:
+		b, err := d.readBoolean()
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatBool(b))
+	case kindInt, kindLong:
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatInt(i, 10))
+	case kindFloat:
+		f, err := d.readFloat()
+		if err != nil {
+			return err
+		}
+		writeJSONFloat(buf, float64(f), 32)
+	case kindDouble:
+		f, err := d.readDouble()
+		if err != nil {
+			return err
+		}
+		writeJSONFloat(buf, f, 64)
+	case kindString:
+		s, err := d.readString()
+		if err != nil {
+			return err
+		}
+		writeJSONString(buf, s)
+	case kindBytes, kindFixed:
+		var b []byte
+		var err error
+		if n.kind == kindBytes {
+			var l int
+			if l, err = d.readLength(); err == nil {
+				b, err = d.next(l)
+			}
+		} else {
+			b, err = d.next(n.size)
+		}
+		if err != nil {
+			return err
+		}
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		writeJSONString(buf, string(runes))
+	case kindEnum:
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if i < 0 || i >= int64(len(n.symbols)) {
+			return fmt.Errorf("invalid enum index %d", i)
+		}
+		writeJSONString(buf, n.symbols[i])
+	case kindArray:
+		buf.WriteByte('[')
+		first := true
+		for {
+			count, err := d.readBlockCount()
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				break
+			}
+			for i := 0; i < count; i++ {
+				if !first {
+					buf.WriteByte(',')
+				}
+				first = false
+				if err := writeJSON(buf, d, n.items); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteByte(']')
+	case kindMap:
+		buf.WriteByte('{')
+		first := true
+		for {
+			count, err := d.readBlockCount()
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				break
+			}
+			for i := 0; i < count; i++ {
+				if !first {
+					buf.WriteByte(',')
+				}
+				first = false
+				key, err := d.readString()
+				if err != nil {
+					return err
+				}
+				writeJSONString(buf, key)
+				buf.WriteByte(':')
+				if err := writeJSON(buf, d, n.values); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteByte('}')
+	case kindRecord:
+		buf.WriteByte('{')
+		for i, f := range n.fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, f.name)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, d, f.typ); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case kindUnion:
+		index, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(n.types)) {
+			return fmt.Errorf("invalid union index %d", index)
+		}
+		branch := n.types[index]
+		if branch.kind == kindNull {
+			buf.WriteString("null")
+			return nil
+		}
+		buf.WriteByte('{')
+		writeJSONString(buf, branchName(branch))
+		buf.WriteByte(':')
+		if err := writeJSON(buf, d, branch); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	// strings always marshal successfully
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+func writeJSONFloat(buf *bytes.Buffer, f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		buf.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		buf.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		buf.WriteString(`"-Infinity"`)
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	}
+}
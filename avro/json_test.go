@@ -0,0 +1,104 @@
+package avro
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnitJSON(t *testing.T) {
+	Convey("Values are encoded as avro JSON with unions wrapped by branch name", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		data := benchmarkData
+		data.Params = map[string]string{"dataset_id": "cpih01"}
+
+		b, err := schema.EncodeJSON(data)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"created":"2018-06-01 12:00:00.000000000 +0000 UTC","service":"dataset-api",`+
+			`"request_id":"abcdefghijklmnop","user":"someone@ons.gov.uk","attempted_action":"put_dataset",`+
+			`"action_result":"successful","params":{"map":{"dataset_id":"cpih01"}}}`)
+
+		var actual benchmarkEvent
+		So(schema.DecodeJSON(b, &actual), ShouldBeNil)
+		So(actual, ShouldResemble, data)
+
+		Convey("and nil values as null", func() {
+			data.Params = nil
+			b, err := schema.EncodeJSON(data)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEndWith, `"params":null}`)
+		})
+	})
+
+	Convey("Every type round trips through the JSON encoding", t, func() {
+		schema := &Schema{Definition: primitivesSchema}
+		observations := int64(math.MaxInt64)
+		note := "provisional é"
+		data := primitives{
+			Ratio:         0.5,
+			Value:         math.Inf(-1),
+			Count:         -42,
+			Total:         1 << 40,
+			Small:         -8,
+			Unsigned:      4000000000,
+			Checksum:      []byte{0, 0x7f, 0xff},
+			Hash:          [4]byte{1, 2, 3, 4},
+			Digest:        []byte{5, 6, 7, 8},
+			State:         "published",
+			PreviousState: 1,
+			Observations:  &observations,
+			Note:          &note,
+		}
+
+		b, err := schema.EncodeJSON(data)
+		So(err, ShouldBeNil)
+
+		var actual primitives
+		So(schema.DecodeJSON(b, &actual), ShouldBeNil)
+		So(actual, ShouldResemble, data)
+	})
+
+	Convey("Named types in unions are wrapped with their full name", t, func() {
+		schema := &Schema{Definition: `{"type": "record", "name": "r", "namespace": "ons", "fields": [
+			{"name": "contact", "type": ["null", {"type": "record", "name": "contact", "fields": [{"name": "name", "type": "string"}]}]}
+		]}`}
+		type contact struct {
+			Name string `avro:"name"`
+		}
+		type r struct {
+			Contact *contact `avro:"contact"`
+		}
+
+		b, err := schema.EncodeJSON(r{Contact: &contact{Name: "bob"}})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"contact":{"ons.contact":{"name":"bob"}}}`)
+
+		var actual r
+		So(schema.DecodeJSON(b, &actual), ShouldBeNil)
+		So(actual.Contact, ShouldResemble, &contact{Name: "bob"})
+	})
+
+	Convey("Fields missing from the JSON take their defaults", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		var actual benchmarkEvent
+		So(schema.DecodeJSON([]byte(`{"user": "bob"}`), &actual), ShouldBeNil)
+		So(actual.User, ShouldEqual, "bob")
+		So(actual.Params, ShouldBeNil)
+	})
+
+	Convey("JSON that does not match the schema returns an error", t, func() {
+		schema := &Schema{Definition: benchmarkSchema}
+		var actual benchmarkEvent
+		for _, data := range []string{
+			`{"user": 1}`,
+			`{"params": {"dataset_id": "cpih01"}}`,
+			`{"params": {"array": []}}`,
+			`{"params": {"map": {}, "null": null}}`,
+			`{} {}`,
+			`{`,
+		} {
+			So(schema.DecodeJSON([]byte(data), &actual), ShouldNotBeNil)
+		}
+	})
+}
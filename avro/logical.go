@@ -0,0 +1,307 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// Logical types supported by the package
+const (
+	logicalDecimal              = "decimal"
+	logicalUUID                 = "uuid"
+	logicalDate                 = "date"
+	logicalTimeMillis           = "time-millis"
+	logicalTimeMicros           = "time-micros"
+	logicalTimestampMillis      = "timestamp-millis"
+	logicalTimestampMicros      = "timestamp-micros"
+	logicalLocalTimestampMillis = "local-timestamp-millis"
+	logicalLocalTimestampMicros = "local-timestamp-micros"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	ratType      = reflect.TypeOf(big.Rat{})
+	ratPtrType   = reflect.TypeOf(&big.Rat{})
+)
+
+// logicalKinds lists the avro type each logical type annotates
+var logicalKinds = map[string]kind{
+	logicalUUID:                 kindString,
+	logicalDate:                 kindInt,
+	logicalTimeMillis:           kindInt,
+	logicalTimeMicros:           kindLong,
+	logicalTimestampMillis:      kindLong,
+	logicalTimestampMicros:      kindLong,
+	logicalLocalTimestampMillis: kindLong,
+	logicalLocalTimestampMicros: kindLong,
+}
+
+// setLogicalType records the logical type of a primitive or fixed schema. As the avro specification requires, logical
+// types that are unknown or invalid for the type they annotate are ignored and the underlying type is used instead.
+func setLogicalType(n *schemaNode, v map[string]interface{}) {
+	logical, _ := v["logicalType"].(string)
+
+	if logical == logicalDecimal {
+		if n.kind != kindBytes && n.kind != kindFixed {
+			return
+		}
+		precision, ok := jsonInt(v["precision"])
+		if !ok || precision <= 0 {
+			return
+		}
+		scale := 0
+		if _, exists := v["scale"]; exists {
+			if scale, ok = jsonInt(v["scale"]); !ok || scale < 0 || scale > precision {
+				return
+			}
+		}
+		if n.kind == kindFixed && float64(precision) > math.Floor(math.Log10(2)*float64(8*n.size-1)) {
+			return
+		}
+		n.logical, n.precision, n.scale = logical, precision, scale
+		return
+	}
+
+	if k, ok := logicalKinds[logical]; ok && k == n.kind {
+		n.logical = logical
+	}
+}
+
+func jsonInt(raw interface{}) (int, bool) {
+	num, ok := raw.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	i, err := num.Int64()
+	if err != nil || i < math.MinInt32 || i > math.MaxInt32 {
+		return 0, false
+	}
+	return int(i), true
+}
+
+// timeEncoder encodes a time.Time as a date, a timestamp or an RFC 3339 string
+func timeEncoder(n *schemaNode) (encodeFunc, error) {
+	switch {
+	case n.kind == kindString:
+		return func(e *encoder, v reflect.Value) error {
+			e.writeString(v.Interface().(time.Time).Format(time.RFC3339Nano))
+			return nil
+		}, nil
+	case n.logical == logicalDate:
+		return func(e *encoder, v reflect.Value) error {
+			y, m, d := v.Interface().(time.Time).Date()
+			days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay
+			if days < math.MinInt32 || days > math.MaxInt32 {
+				return fmt.Errorf("date %d-%02d-%02d overflows avro date", y, m, d)
+			}
+			e.writeLong(days)
+			return nil
+		}, nil
+	case n.logical == logicalTimestampMillis || n.logical == logicalLocalTimestampMillis:
+		return func(e *encoder, v reflect.Value) error {
+			e.writeLong(v.Interface().(time.Time).UnixMilli())
+			return nil
+		}, nil
+	case n.logical == logicalTimestampMicros || n.logical == logicalLocalTimestampMicros:
+		return func(e *encoder, v reflect.Value) error {
+			e.writeLong(v.Interface().(time.Time).UnixMicro())
+			return nil
+		}, nil
+	}
+	return nil, ErrTypeMismatch(timeType, n.typeName())
+}
+
+func timeDecoder(n *schemaNode) (decodeFunc, error) {
+	switch {
+	case n.kind == kindString:
+		return func(d *decoder, v reflect.Value) error {
+			s, err := d.readString()
+			if err != nil {
+				return err
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}, nil
+	case n.logical == logicalDate:
+		return func(d *decoder, v reflect.Value) error {
+			days, err := d.readInt()
+			v.Set(reflect.ValueOf(time.Unix(int64(days)*secondsPerDay, 0).UTC()))
+			return err
+		}, nil
+	case n.logical == logicalTimestampMillis || n.logical == logicalLocalTimestampMillis:
+		return func(d *decoder, v reflect.Value) error {
+			ms, err := d.readLong()
+			v.Set(reflect.ValueOf(time.UnixMilli(ms).UTC()))
+			return err
+		}, nil
+	case n.logical == logicalTimestampMicros || n.logical == logicalLocalTimestampMicros:
+		return func(d *decoder, v reflect.Value) error {
+			us, err := d.readLong()
+			v.Set(reflect.ValueOf(time.UnixMicro(us).UTC()))
+			return err
+		}, nil
+	}
+	return nil, ErrTypeMismatch(timeType, n.typeName())
+}
+
+// durationUnit returns the unit of a time of day logical type, or zero if n is not one
+func durationUnit(n *schemaNode) time.Duration {
+	switch n.logical {
+	case logicalTimeMillis:
+		return time.Millisecond
+	case logicalTimeMicros:
+		return time.Microsecond
+	}
+	return 0
+}
+
+// durationEncoder encodes a time.Duration as a time-millis or time-micros value
+func durationEncoder(n *schemaNode) encodeFunc {
+	unit := durationUnit(n)
+	return func(e *encoder, v reflect.Value) error {
+		i := v.Int() / int64(unit)
+		if n.kind == kindInt && (i < math.MinInt32 || i > math.MaxInt32) {
+			return fmt.Errorf("duration %v overflows avro %s", time.Duration(v.Int()), n.logical)
+		}
+		e.writeLong(i)
+		return nil
+	}
+}
+
+func durationDecoder(n *schemaNode) decodeFunc {
+	unit := durationUnit(n)
+	return func(d *decoder, v reflect.Value) error {
+		i, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if n.kind == kindInt && (i < math.MinInt32 || i > math.MaxInt32) {
+			return errVarintOverflow
+		}
+		v.SetInt(i * int64(unit))
+		return nil
+	}
+}
+
+// decimalEncoder encodes a big.Rat or *big.Rat as the two's complement bytes of its unscaled value
+func decimalEncoder(n *schemaNode, t reflect.Type) (encodeFunc, error) {
+	if n.logical != logicalDecimal {
+		return nil, ErrTypeMismatch(t, n.typeName())
+	}
+
+	return func(e *encoder, v reflect.Value) error {
+		var r *big.Rat
+		if t == ratPtrType {
+			if v.IsNil() {
+				return fmt.Errorf("nil decimal cannot be encoded as avro %s", n.typeName())
+			}
+			r = v.Interface().(*big.Rat)
+		} else {
+			rat := v.Interface().(big.Rat)
+			r = &rat
+		}
+
+		b, err := decimalBytes(r, n)
+		if err != nil {
+			return err
+		}
+		if n.kind == kindBytes {
+			e.writeBytes(b)
+			return nil
+		}
+
+		// fixed decimals are sign extended to the size of the fixed type
+		pad := byte(0)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			pad = 0xff
+		}
+		for i := len(b); i < n.size; i++ {
+			e.buf = append(e.buf, pad)
+		}
+		e.buf = append(e.buf, b...)
+		return nil
+	}, nil
+}
+
+func decimalDecoder(n *schemaNode, t reflect.Type) (decodeFunc, error) {
+	if n.logical != logicalDecimal {
+		return nil, ErrTypeMismatch(t, n.typeName())
+	}
+
+	denominator := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n.scale)), nil)
+	return func(d *decoder, v reflect.Value) error {
+		var b []byte
+		var err error
+		if n.kind == kindBytes {
+			var l int
+			if l, err = d.readLength(); err == nil {
+				b, err = d.next(l)
+			}
+		} else {
+			b, err = d.next(n.size)
+		}
+		if err != nil {
+			return err
+		}
+
+		r := new(big.Rat).SetFrac(twosComplementInt(b), denominator)
+		if t == ratPtrType {
+			v.Set(reflect.ValueOf(r))
+		} else {
+			v.Set(reflect.ValueOf(r).Elem())
+		}
+		return nil
+	}, nil
+}
+
+// decimalBytes returns the big-endian two's complement bytes of the unscaled value of r
+func decimalBytes(r *big.Rat, n *schemaNode) ([]byte, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n.scale)), nil)))
+	if !scaled.IsInt() {
+		return nil, fmt.Errorf("decimal %s cannot be represented with scale %d", r.RatString(), n.scale)
+	}
+
+	unscaled := scaled.Num()
+	if len(new(big.Int).Abs(unscaled).String()) > n.precision {
+		return nil, fmt.Errorf("decimal %s exceeds precision %d", r.RatString(), n.precision)
+	}
+
+	var b []byte
+	if unscaled.Sign() >= 0 {
+		b = unscaled.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+	} else {
+		// the shortest two's complement representation of a negative number x takes (|x|-1).BitLen()/8 + 1 bytes
+		abs := new(big.Int).Neg(unscaled)
+		size := new(big.Int).Sub(abs, big.NewInt(1)).BitLen()/8 + 1
+		complement := new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+		b = complement.Add(complement, unscaled).Bytes()
+	}
+
+	if n.kind == kindFixed && len(b) > n.size {
+		return nil, fmt.Errorf("decimal %s does not fit in avro %s", r.RatString(), n.typeName())
+	}
+	return b, nil
+}
+
+// twosComplementInt converts big-endian two's complement bytes to an integer
+func twosComplementInt(b []byte) *big.Int {
+	i := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return i
+}
@@ -0,0 +1,146 @@
+package avro
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var logicalSchema = `{
+  "type": "record",
+  "name": "dataset-release",
+  "fields": [
+    {"name": "released", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "updated", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "next_release", "type": ["null", {"type": "int", "logicalType": "date"}], "default": null},
+    {"name": "published", "type": "string"},
+    {"name": "embargo", "type": {"type": "int", "logicalType": "time-millis"}},
+    {"name": "observation", "type": {"type": "bytes", "logicalType": "decimal", "precision": 9, "scale": 2}},
+    {"name": "index", "type": ["null", {"type": "fixed", "name": "index", "size": 4, "logicalType": "decimal", "precision": 6, "scale": 1}]},
+    {"name": "id", "type": {"type": "string", "logicalType": "uuid"}}
+  ]
+}`
+
+type datasetRelease struct {
+	Released    time.Time     `avro:"released"`
+	Updated     time.Time     `avro:"updated"`
+	NextRelease *time.Time    `avro:"next_release"`
+	Published   time.Time     `avro:"published"`
+	Embargo     time.Duration `avro:"embargo"`
+	Observation big.Rat       `avro:"observation"`
+	Index       *big.Rat      `avro:"index"`
+	ID          string        `avro:"id"`
+}
+
+func TestUnitLogicalTypes(t *testing.T) {
+	schema := &Schema{Definition: logicalSchema}
+	released := time.Date(2018, time.June, 14, 9, 30, 0, 123000000, time.UTC)
+	nextRelease := time.Date(2018, time.July, 12, 0, 0, 0, 0, time.UTC)
+
+	Convey("Logical types round trip through their Go equivalents", t, func() {
+		data := datasetRelease{
+			Released:    released,
+			Updated:     released.Add(456 * time.Microsecond),
+			NextRelease: &nextRelease,
+			Published:   time.Date(2018, time.June, 14, 9, 30, 0, 1, time.FixedZone("BST", 3600)),
+			Embargo:     9*time.Hour + 30*time.Minute,
+			Observation: *big.NewRat(-12345, 100),
+			Index:       big.NewRat(1025, 10),
+			ID:          "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+		}
+
+		b, err := schema.Marshal(data)
+		So(err, ShouldBeNil)
+
+		var actual datasetRelease
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual.Released, ShouldResemble, released)
+		So(actual.Updated, ShouldResemble, released.Add(456*time.Microsecond))
+		So(*actual.NextRelease, ShouldResemble, nextRelease)
+		So(actual.Published.Equal(data.Published), ShouldBeTrue)
+		So(actual.Embargo, ShouldEqual, data.Embargo)
+		So(actual.Observation.Cmp(big.NewRat(-12345, 100)), ShouldEqual, 0)
+		So(actual.Index.Cmp(big.NewRat(1025, 10)), ShouldEqual, 0)
+		So(actual.ID, ShouldEqual, data.ID)
+	})
+
+	Convey("Nil pointers are written as null", t, func() {
+		b, err := schema.Marshal(datasetRelease{Published: released})
+		So(err, ShouldBeNil)
+
+		actual := datasetRelease{NextRelease: &nextRelease, Index: big.NewRat(1, 1)}
+		err = schema.Unmarshal(b, &actual)
+		So(err, ShouldBeNil)
+		So(actual.NextRelease, ShouldBeNil)
+		So(actual.Index, ShouldBeNil)
+	})
+
+	Convey("Timestamps are encoded as milliseconds since the epoch", t, func() {
+		e := &encoder{}
+		enc, err := timeEncoder(&schemaNode{kind: kindLong, logical: logicalTimestampMillis})
+		So(err, ShouldBeNil)
+		So(enc(e, reflect.ValueOf(time.Unix(1, 0))), ShouldBeNil)
+
+		d := &decoder{buf: e.buf}
+		ms, err := d.readLong()
+		So(err, ShouldBeNil)
+		So(ms, ShouldEqual, 1000)
+	})
+
+	Convey("Decimals that cannot be represented exactly return an error", t, func() {
+		_, err := schema.Marshal(datasetRelease{Published: released, Observation: *big.NewRat(1, 3)})
+		So(err, ShouldNotBeNil)
+
+		_, err = schema.Marshal(datasetRelease{Published: released, Observation: *big.NewRat(10000000000, 1)})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Decimals are encoded as two's complement bytes", t, func() {
+		for _, tc := range []struct {
+			value    int64
+			expected []byte
+		}{
+			{0, []byte{0x00}},
+			{1, []byte{0x01}},
+			{127, []byte{0x7f}},
+			{128, []byte{0x00, 0x80}},
+			{-1, []byte{0xff}},
+			{-128, []byte{0x80}},
+			{-129, []byte{0xff, 0x7f}},
+		} {
+			b, err := decimalBytes(big.NewRat(tc.value, 1), &schemaNode{kind: kindBytes, precision: 10})
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, tc.expected)
+			So(twosComplementInt(b).Int64(), ShouldEqual, tc.value)
+		}
+	})
+
+	Convey("Invalid logical types are ignored", t, func() {
+		n, err := parseSchema(`{"type": "string", "logicalType": "timestamp-millis"}`)
+		So(err, ShouldBeNil)
+		So(n.logical, ShouldBeEmpty)
+
+		n, err = parseSchema(`{"type": "bytes", "logicalType": "decimal", "precision": 2, "scale": 3}`)
+		So(err, ShouldBeNil)
+		So(n.logical, ShouldBeEmpty)
+
+		n, err = parseSchema(`{"type": "fixed", "name": "small", "size": 1, "logicalType": "decimal", "precision": 3}`)
+		So(err, ShouldBeNil)
+		So(n.logical, ShouldBeEmpty)
+
+		Convey("and time.Time cannot be used with the underlying type", func() {
+			type timestamp struct {
+				At time.Time `avro:"at"`
+			}
+			s := &Schema{Definition: `{"type": "record", "name": "r", "fields": [
+				{"name": "at", "type": {"type": "long", "logicalType": "unknown"}}
+			]}`}
+			_, err := s.Marshal(timestamp{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,366 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// kind identifies the avro type of a parsed schema node
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBoolean
+	kindInt
+	kindLong
+	kindFloat
+	kindDouble
+	kindBytes
+	kindString
+	kindRecord
+	kindEnum
+	kindArray
+	kindMap
+	kindUnion
+	kindFixed
+)
+
+var kindNames = [...]string{
+	kindNull:    "null",
+	kindBoolean: "boolean",
+	kindInt:     "int",
+	kindLong:    "long",
+	kindFloat:   "float",
+	kindDouble:  "double",
+	kindBytes:   "bytes",
+	kindString:  "string",
+	kindRecord:  "record",
+	kindEnum:    "enum",
+	kindArray:   "array",
+	kindMap:     "map",
+	kindUnion:   "union",
+	kindFixed:   "fixed",
+}
+
+var primitiveKinds = map[string]kind{
+	"null":    kindNull,
+	"boolean": kindBoolean,
+	"int":     kindInt,
+	"long":    kindLong,
+	"float":   kindFloat,
+	"double":  kindDouble,
+	"bytes":   kindBytes,
+	"string":  kindString,
+}
+
+func (k kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// schemaNode is the parsed representation of an avro schema. Named types (records, enums and fixed) are shared between
+// every place they are referenced, so a recursive record contains a pointer back to itself.
+type schemaNode struct {
+	kind    kind
+	name    string
+	aliases []string
+	doc     string
+	fields  []*schemaField
+	items   *schemaNode
+	values  *schemaNode
+	types   []*schemaNode
+	symbols []string
+	size    int
+
+	// enumDefault is the symbol used when reading a symbol written by another version of an enum that it doesn't have
+	enumDefault string
+
+	// logical is the logical type annotating a primitive or fixed type, with the precision and scale of decimals
+	logical   string
+	precision int
+	scale     int
+}
+
+// schemaField is a single field of a record schema
+type schemaField struct {
+	name       string
+	aliases    []string
+	doc        string
+	typ        *schemaNode
+	def        interface{}
+	hasDefault bool
+}
+
+// typeName returns the name used to describe the node in error messages
+func (n *schemaNode) typeName() string {
+	if n.name != "" {
+		return n.name
+	}
+	return n.kind.String()
+}
+
+// isNamed reports whether the node is a record, enum or fixed type
+func (n *schemaNode) isNamed() bool {
+	return n.kind == kindRecord || n.kind == kindEnum || n.kind == kindFixed
+}
+
+// field returns the record field with the given name, or nil if there is none
+func (n *schemaNode) field(name string) *schemaField {
+	for _, f := range n.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// nullIndex returns the position of the null branch of a union, or -1 if the union is not nullable
+func (n *schemaNode) nullIndex() int {
+	for i, t := range n.types {
+		if t.kind == kindNull {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSchema parses an avro schema definition in its JSON form. go-avro's ParseSchema is not used because it drops
+// the logicalType of primitive types and the aliases of records and fields, which schema resolution and logical types
+// depend on, and it panics on definitions missing a name or fields.
+func parseSchema(definition string) (*schemaNode, error) {
+	dec := json.NewDecoder(strings.NewReader(definition))
+	dec.UseNumber()
+
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %v", err)
+	}
+
+	p := &schemaParser{named: make(map[string]*schemaNode)}
+	return p.parse(raw, "")
+}
+
+// schemaParser keeps track of the named types declared so far in a schema so that they can be referenced by name
+type schemaParser struct {
+	named map[string]*schemaNode
+}
+
+func (p *schemaParser) parse(raw interface{}, namespace string) (*schemaNode, error) {
+	switch v := raw.(type) {
+	case string:
+		if k, ok := primitiveKinds[v]; ok {
+			return &schemaNode{kind: k}, nil
+		}
+		if n, ok := p.named[fullName(v, namespace)]; ok {
+			return n, nil
+		}
+		if n, ok := p.named[v]; ok {
+			return n, nil
+		}
+		return nil, fmt.Errorf("invalid avro schema: unknown type %q", v)
+	case []interface{}:
+		return p.parseUnion(v, namespace)
+	case map[string]interface{}:
+		return p.parseObject(v, namespace)
+	}
+	return nil, fmt.Errorf("invalid avro schema: unexpected %T", raw)
+}
+
+func (p *schemaParser) parseObject(v map[string]interface{}, namespace string) (*schemaNode, error) {
+	typ, ok := v["type"].(string)
+	if !ok {
+		// {"type": [...]} or {"type": {...}} wraps another schema
+		if _, exists := v["type"]; !exists {
+			return nil, fmt.Errorf("invalid avro schema: missing type")
+		}
+		return p.parse(v["type"], namespace)
+	}
+
+	switch typ {
+	case "record", "error":
+		return p.parseRecord(v, namespace)
+	case "enum":
+		return p.parseEnum(v, namespace)
+	case "fixed":
+		return p.parseFixed(v, namespace)
+	case "array":
+		items, err := p.parse(v["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{kind: kindArray, items: items}, nil
+	case "map":
+		values, err := p.parse(v["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{kind: kindMap, values: values}, nil
+	}
+
+	if k, ok := primitiveKinds[typ]; ok {
+		n := &schemaNode{kind: k}
+		setLogicalType(n, v)
+		return n, nil
+	}
+	return p.parse(typ, namespace)
+}
+
+func (p *schemaParser) parseUnion(v []interface{}, namespace string) (*schemaNode, error) {
+	if len(v) == 0 {
+		return nil, fmt.Errorf("invalid avro schema: unions must have at least one type")
+	}
+	n := &schemaNode{kind: kindUnion, types: make([]*schemaNode, 0, len(v))}
+	for _, raw := range v {
+		t, err := p.parse(raw, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == kindUnion {
+			return nil, fmt.Errorf("invalid avro schema: unions may not immediately contain other unions")
+		}
+		n.types = append(n.types, t)
+	}
+	return n, nil
+}
+
+// declare parses the name, namespace and aliases of a named type and registers it with the parser. The namespace that
+// applies to the types nested within it is returned.
+func (p *schemaParser) declare(n *schemaNode, v map[string]interface{}, namespace string) (string, error) {
+	name, ok := v["name"].(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("invalid avro schema: %s is missing a name", n.kind)
+	}
+	if ns, ok := v["namespace"].(string); ok && !strings.ContainsRune(name, '.') {
+		namespace = ns
+	}
+	n.name = fullName(name, namespace)
+	if i := strings.LastIndexByte(n.name, '.'); i >= 0 {
+		namespace = n.name[:i]
+	}
+
+	aliases, err := stringList(v["aliases"], "aliases")
+	if err != nil {
+		return "", err
+	}
+	for _, alias := range aliases {
+		n.aliases = append(n.aliases, fullName(alias, namespace))
+	}
+	n.doc, _ = v["doc"].(string)
+
+	if _, exists := p.named[n.name]; exists {
+		return "", fmt.Errorf("invalid avro schema: %q is defined more than once", n.name)
+	}
+	p.named[n.name] = n
+	return namespace, nil
+}
+
+func (p *schemaParser) parseRecord(v map[string]interface{}, namespace string) (*schemaNode, error) {
+	n := &schemaNode{kind: kindRecord}
+	namespace, err := p.declare(n, v, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rawFields, ok := v["fields"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid avro schema: record %q is missing fields", n.name)
+	}
+
+	for _, raw := range rawFields {
+		rf, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid avro schema: record %q has an invalid field", n.name)
+		}
+		f := &schemaField{}
+		if f.name, ok = rf["name"].(string); !ok || f.name == "" {
+			return nil, fmt.Errorf("invalid avro schema: record %q has a field without a name", n.name)
+		}
+		if n.field(f.name) != nil {
+			return nil, fmt.Errorf("invalid avro schema: record %q has more than one field named %q", n.name, f.name)
+		}
+		if f.aliases, err = stringList(rf["aliases"], "aliases"); err != nil {
+			return nil, err
+		}
+		f.doc, _ = rf["doc"].(string)
+		f.def, f.hasDefault = rf["default"]
+
+		if f.typ, err = p.parse(rf["type"], namespace); err != nil {
+			return nil, err
+		}
+		n.fields = append(n.fields, f)
+	}
+	return n, nil
+}
+
+func (p *schemaParser) parseEnum(v map[string]interface{}, namespace string) (*schemaNode, error) {
+	n := &schemaNode{kind: kindEnum}
+	if _, err := p.declare(n, v, namespace); err != nil {
+		return nil, err
+	}
+
+	symbols, err := stringList(v["symbols"], "symbols")
+	if err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("invalid avro schema: enum %q has no symbols", n.name)
+	}
+	n.symbols = symbols
+
+	if def, ok := v["default"].(string); ok {
+		if symbolIndex(symbols, def) < 0 {
+			return nil, fmt.Errorf("invalid avro schema: enum %q default %q is not one of its symbols", n.name, def)
+		}
+		n.enumDefault = def
+	}
+	return n, nil
+}
+
+func (p *schemaParser) parseFixed(v map[string]interface{}, namespace string) (*schemaNode, error) {
+	n := &schemaNode{kind: kindFixed}
+	if _, err := p.declare(n, v, namespace); err != nil {
+		return nil, err
+	}
+
+	size, ok := v["size"].(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("invalid avro schema: fixed %q is missing a size", n.name)
+	}
+	s, err := size.Int64()
+	if err != nil || s < 0 {
+		return nil, fmt.Errorf("invalid avro schema: fixed %q has an invalid size", n.name)
+	}
+	n.size = int(s)
+	setLogicalType(n, v)
+	return n, nil
+}
+
+// fullName qualifies name with namespace unless it is already a full name
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.ContainsRune(name, '.') {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func stringList(raw interface{}, attribute string) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid avro schema: %s must be an array of strings", attribute)
+	}
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid avro schema: %s must be an array of strings", attribute)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
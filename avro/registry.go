@@ -0,0 +1,176 @@
+package avro
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSchemaNotFound is returned by a SchemaRegistry when no schema is registered with an id or under a subject
+var ErrSchemaNotFound = errors.New("schema not found in registry")
+
+// SchemaRegistry looks up and registers the schemas messages are written with, by id and by subject
+type SchemaRegistry interface {
+	// SchemaByID returns the schema registered with id
+	SchemaByID(ctx context.Context, id int) (*Schema, error)
+	// LatestSchema returns the most recently registered schema under subject and its id
+	LatestSchema(ctx context.Context, subject string) (int, *Schema, error)
+	// Register registers schema under subject, if it isn't already, and returns its id
+	Register(ctx context.Context, subject string, schema *Schema) (int, error)
+}
+
+// subjectSchema identifies a schema definition registered under a subject
+type subjectSchema struct {
+	subject    string
+	definition string
+}
+
+// CachedRegistry keeps the schemas looked up in, and registered with, another SchemaRegistry so that each is only
+// requested once. Schemas are cached by id, which never changes the schema it refers to, so the same *Schema, and
+// therefore the same compiled codec, is returned for every message written with it. The latest schema of a subject can
+// change and is always looked up. A CachedRegistry is safe for concurrent use.
+type CachedRegistry struct {
+	registry SchemaRegistry
+
+	mu      sync.RWMutex
+	schemas map[int]*Schema
+	ids     map[subjectSchema]int
+}
+
+// NewCachedRegistry returns a CachedRegistry in front of registry
+func NewCachedRegistry(registry SchemaRegistry) *CachedRegistry {
+	return &CachedRegistry{
+		registry: registry,
+		schemas:  make(map[int]*Schema),
+		ids:      make(map[subjectSchema]int),
+	}
+}
+
+// SchemaByID returns the schema registered with id
+func (r *CachedRegistry) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := r.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.store(id, schema), nil
+}
+
+// LatestSchema returns the most recently registered schema under subject and its id
+func (r *CachedRegistry) LatestSchema(ctx context.Context, subject string) (int, *Schema, error) {
+	id, schema, err := r.registry.LatestSchema(ctx, subject)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, r.store(id, schema), nil
+}
+
+// Register registers schema under subject, if it isn't already, and returns its id
+func (r *CachedRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	key := subjectSchema{subject, schema.Definition}
+
+	r.mu.RLock()
+	id, ok := r.ids[key]
+	r.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	id, err := r.registry.Register(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	r.ids[key] = id
+	if _, ok := r.schemas[id]; !ok {
+		r.schemas[id] = schema
+	}
+	r.mu.Unlock()
+	return id, nil
+}
+
+// store caches schema under id, returning the schema already cached if there is one
+func (r *CachedRegistry) store(id int, schema *Schema) *Schema {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cached, ok := r.schemas[id]; ok {
+		return cached
+	}
+	r.schemas[id] = schema
+	return schema
+}
+
+// MemoryRegistry is a SchemaRegistry held in memory, for use in tests and tools without a schema registry service.
+// As with the Confluent registry, a definition registered under several subjects has a single id. A MemoryRegistry is
+// safe for concurrent use.
+type MemoryRegistry struct {
+	mu       sync.RWMutex
+	schemas  []*Schema
+	ids      map[string]int
+	subjects map[string][]int
+}
+
+// NewMemoryRegistry returns an empty MemoryRegistry
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		ids:      make(map[string]int),
+		subjects: make(map[string][]int),
+	}
+}
+
+// SchemaByID returns the schema registered with id
+func (r *MemoryRegistry) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id < 1 || id > len(r.schemas) {
+		return nil, ErrSchemaNotFound
+	}
+	return r.schemas[id-1], nil
+}
+
+// LatestSchema returns the most recently registered schema under subject and its id
+func (r *MemoryRegistry) LatestSchema(ctx context.Context, subject string) (int, *Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return 0, nil, ErrSchemaNotFound
+	}
+	id := versions[len(versions)-1]
+	return id, r.schemas[id-1], nil
+}
+
+// Register registers schema under subject, if it isn't already, and returns its id. Ids start at 1.
+func (r *MemoryRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	if _, err := schema.compiled(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.ids[schema.Definition]
+	if !ok {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+		r.ids[schema.Definition] = id
+	}
+
+	for _, version := range r.subjects[subject] {
+		if version == id {
+			return id, nil
+		}
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id, nil
+}
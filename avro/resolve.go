@@ -0,0 +1,388 @@
+package avro
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// resolveKey identifies a decoder that reads data written with one schema into a Go type bound to another
+type resolveKey struct {
+	writer *codec
+	typ    reflect.Type
+}
+
+// UnmarshalFrom parses avro encoded data written with the writer schema and stores the result in the value pointed to
+// by s, which is bound to this schema. The avro schema resolution rules are applied, so fields the writer didn't have
+// take their defaults, fields this schema doesn't have are skipped, numbers are promoted to wider types and records,
+// enums, fixed types and fields are matched by name or alias.
+func (schema *Schema) UnmarshalFrom(writer *Schema, message []byte, s interface{}) error {
+	return schema.decode(&decoder{buf: message}, writer, s)
+}
+
+// resolverFor returns the decoder for data written with the writer schema into values of type t, compiling it if this
+// is the first time the pair has been seen
+func (c *codec) resolverFor(writer *codec, t reflect.Type) (decodeFunc, error) {
+	if writer == c {
+		return c.decoderFor(t)
+	}
+
+	key := resolveKey{writer, t}
+	if f, ok := c.resolvers.Load(key); ok {
+		return f.(decodeFunc), nil
+	}
+
+	f, err := newCompiler().resolvingDecoder(writer.schema, c.schema, t)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := c.resolvers.LoadOrStore(key, f)
+	return actual.(decodeFunc), nil
+}
+
+// resolvingKey identifies a compiled resolving plan by the writer and reader schemas and the Go type it binds together
+type resolvingKey struct {
+	writer, reader *schemaNode
+	typ            reflect.Type
+}
+
+// resolvingDecoder compiles a decoder that reads values written with schema w into the Go type t bound to schema r
+func (c *compiler) resolvingDecoder(w, r *schemaNode, t reflect.Type) (decodeFunc, error) {
+	if w.kind == kindUnion {
+		return c.writerUnionDecoder(w, r, t)
+	}
+
+	if r.kind == kindUnion {
+		for _, branch := range r.types {
+			if schemasMatch(w, branch) {
+				return c.resolvingDecoder(w, branch, t)
+			}
+		}
+		return nil, errCannotResolve(w, r)
+	}
+
+	if !schemasMatch(w, r) {
+		return nil, errCannotResolve(w, r)
+	}
+
+	if w.kind == kindNull {
+		zero := reflect.Zero(t)
+		return func(d *decoder, v reflect.Value) error {
+			v.Set(zero)
+			return nil
+		}, nil
+	}
+
+	if t.Kind() == reflect.Ptr && t != ratPtrType {
+		dec, err := c.resolvingDecoder(w, r, t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decoder, v reflect.Value) error {
+			if v.IsNil() {
+				v.Set(reflect.New(t.Elem()))
+			}
+			return dec(d, v.Elem())
+		}, nil
+	}
+
+	switch {
+	case w.kind == kindRecord:
+		return c.recordResolver(w, r, t)
+	case w.kind == kindArray:
+		if t.Kind() != reflect.Slice {
+			return nil, ErrTypeMismatch(t, r.typeName())
+		}
+		dec, err := c.resolvingDecoder(w.items, r.items, t.Elem())
+		if err != nil {
+			return nil, inField(err, "[]", "[]", t.Elem(), r.items)
+		}
+		return arrayDecoder(t, r.items, dec), nil
+	case w.kind == kindMap:
+		if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+			return nil, ErrTypeMismatch(t, r.typeName())
+		}
+		dec, err := c.resolvingDecoder(w.values, r.values, t.Elem())
+		if err != nil {
+			return nil, inField(err, "{}", "{}", t.Elem(), r.values)
+		}
+		return mapDecoder(t, r.values, dec, c.depth > 1), nil
+	case w.kind == kindEnum:
+		return c.enumResolver(w, r, t)
+	case w.kind != r.kind && isNumeric(w.kind):
+		return c.promotingDecoder(w, r, t)
+	}
+
+	// everything else, including strings read as bytes and bytes read as strings, has the same encoding for both
+	return c.decoder(r, t)
+}
+
+// writerUnionDecoder reads a union by resolving whichever branch the writer used against the reader schema. Branches
+// that cannot be resolved are only an error if a value actually uses them.
+func (c *compiler) writerUnionDecoder(w, r *schemaNode, t reflect.Type) (decodeFunc, error) {
+	decoders := make([]decodeFunc, len(w.types))
+	errs := make([]error, len(w.types))
+	resolved := false
+	for i, branch := range w.types {
+		if decoders[i], errs[i] = c.resolvingDecoder(branch, r, t); errs[i] == nil {
+			resolved = true
+		}
+	}
+	if !resolved {
+		return nil, errs[0]
+	}
+
+	return func(d *decoder, v reflect.Value) error {
+		index, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(w.types)) {
+			return fmt.Errorf("invalid union index %d", index)
+		}
+		if decoders[index] == nil {
+			return errs[index]
+		}
+		return decoders[index](d, v)
+	}, nil
+}
+
+// fieldDefault is a reader field the writer didn't have, set from the encoded default of the reader schema
+type fieldDefault struct {
+	index  int
+	decode decodeFunc
+	value  []byte
+	field  *schemaField
+}
+
+func (c *compiler) recordResolver(w, r *schemaNode, t reflect.Type) (decodeFunc, error) {
+	if t.Kind() != reflect.Struct || t == timeType || t == ratType {
+		return nil, ErrTypeMismatch(t, r.typeName())
+	}
+
+	key := resolvingKey{w, r, t}
+	if f, ok := c.resolving[key]; ok {
+		return func(d *decoder, v reflect.Value) error { return (*f)(d, v) }, nil
+	}
+
+	if err := checkFieldType(t); err != nil {
+		return nil, err
+	}
+
+	var f decodeFunc
+	c.resolving[key] = &f
+
+	c.depth++
+	defer func() { c.depth-- }()
+
+	indexes := structFields(t)
+	plan := make([]fieldDecoder, len(w.fields))
+	read := make(map[*schemaField]bool, len(w.fields))
+	for i, wf := range w.fields {
+		rf := readerField(r, wf.name)
+		if rf != nil {
+			read[rf] = true
+		}
+
+		index, ok := 0, false
+		if rf != nil {
+			index, ok = indexes[rf.name]
+		}
+		if !ok {
+			plan[i] = fieldDecoder{index: -1, skip: wf.typ}
+			continue
+		}
+
+		sf := t.Field(index)
+		dec, err := c.resolvingDecoder(wf.typ, rf.typ, sf.Type)
+		if err != nil {
+			return nil, inField(err, sf.Name, rf.name, sf.Type, rf.typ)
+		}
+		plan[i] = fieldDecoder{index: index, decode: dec}
+	}
+
+	var defaults []fieldDefault
+	for _, rf := range r.fields {
+		if read[rf] {
+			continue
+		}
+		if !rf.hasDefault {
+			return nil, ErrMissingField(rf.name)
+		}
+		index, ok := indexes[rf.name]
+		if !ok {
+			continue
+		}
+
+		sf := t.Field(index)
+		e := &encoder{}
+		if err := encodeDefault(e, rf.typ, rf.def); err != nil {
+			return nil, inField(err, sf.Name, rf.name, sf.Type, rf.typ)
+		}
+		dec, err := c.decoder(rf.typ, sf.Type)
+		if err != nil {
+			return nil, inField(err, sf.Name, rf.name, sf.Type, rf.typ)
+		}
+		defaults = append(defaults, fieldDefault{index: index, decode: dec, value: e.buf, field: rf})
+	}
+
+	return nestedDecoder(func(d *decoder, v reflect.Value) error {
+		for i := range plan {
+			if err := plan[i].read(d, v, t, w.fields[i]); err != nil {
+				return err
+			}
+		}
+		for i := range defaults {
+			if err := defaults[i].decode(&decoder{buf: defaults[i].value}, v.Field(defaults[i].index)); err != nil {
+				sf, rf := t.Field(defaults[i].index), defaults[i].field
+				return inField(err, sf.Name, rf.name, sf.Type, rf.typ)
+			}
+		}
+		return nil
+	}, &f), nil
+}
+
+// readerField returns the field of the reader record that reads the writer field called name, matching it by name or
+// by one of the reader field's aliases
+func readerField(r *schemaNode, name string) *schemaField {
+	if f := r.field(name); f != nil {
+		return f
+	}
+	for _, f := range r.fields {
+		for _, alias := range f.aliases {
+			if alias == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// enumResolver reads an enum symbol written with the writer's symbols as the same symbol of the reader enum, or as
+// the reader's default symbol if it doesn't have it
+func (c *compiler) enumResolver(w, r *schemaNode, t reflect.Type) (decodeFunc, error) {
+	dec, err := c.decoder(r, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// the reader's ordinal for each writer symbol is encoded up front and decoded with the reader's own decoder
+	ordinals := make([][]byte, len(w.symbols))
+	for i, symbol := range w.symbols {
+		index := symbolIndex(r.symbols, symbol)
+		if index < 0 && r.enumDefault != "" {
+			index = symbolIndex(r.symbols, r.enumDefault)
+		}
+		if index >= 0 {
+			e := &encoder{}
+			e.writeLong(int64(index))
+			ordinals[i] = e.buf
+		}
+	}
+
+	return func(d *decoder, v reflect.Value) error {
+		index, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(w.symbols)) {
+			return fmt.Errorf("invalid enum index %d", index)
+		}
+		if ordinals[index] == nil {
+			return fmt.Errorf("symbol %q is not in enum %s and it has no default", w.symbols[index], r.name)
+		}
+		return dec(&decoder{buf: ordinals[index]}, v)
+	}, nil
+}
+
+// promotingDecoder reads an int, long or float written by the writer as the wider numeric type of the reader
+func (c *compiler) promotingDecoder(w, r *schemaNode, t reflect.Type) (decodeFunc, error) {
+	dec, err := c.decoder(r, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// int and long share an encoding, so only promotions to floating point need the value converting
+	if r.kind == kindLong {
+		return dec, nil
+	}
+
+	return func(d *decoder, v reflect.Value) error {
+		var f float64
+		if w.kind == kindFloat {
+			f32, err := d.readFloat()
+			if err != nil {
+				return err
+			}
+			f = float64(f32)
+		} else {
+			i, err := d.readLong()
+			if err != nil {
+				return err
+			}
+			f = float64(i)
+		}
+
+		e := encoder{buf: make([]byte, 0, 8)}
+		if r.kind == kindFloat {
+			e.writeFloat(float32(f))
+		} else {
+			e.writeDouble(f)
+		}
+		return dec(&decoder{buf: e.buf}, v)
+	}, nil
+}
+
+func isNumeric(k kind) bool {
+	return k == kindInt || k == kindLong || k == kindFloat || k == kindDouble
+}
+
+// schemasMatch reports whether data written with schema w can be read with schema r without looking inside unions,
+// records, arrays or maps: they must be the same type, with named types having the same unqualified name or w's name
+// being an alias of r, or w must be promotable to r
+func schemasMatch(w, r *schemaNode) bool {
+	if w.kind == kindUnion || r.kind == kindUnion {
+		return true
+	}
+
+	switch w.kind {
+	case kindInt:
+		return r.kind == kindInt || r.kind == kindLong || r.kind == kindFloat || r.kind == kindDouble
+	case kindLong:
+		return r.kind == kindLong || r.kind == kindFloat || r.kind == kindDouble
+	case kindFloat:
+		return r.kind == kindFloat || r.kind == kindDouble
+	case kindString, kindBytes:
+		return r.kind == kindString || r.kind == kindBytes
+	}
+
+	if w.kind != r.kind {
+		return false
+	}
+	if w.isNamed() && !namesMatch(w, r) {
+		return false
+	}
+	return w.kind != kindFixed || w.size == r.size
+}
+
+// namesMatch reports whether the named types w and r have the same unqualified name, or w is known to r by an alias
+func namesMatch(w, r *schemaNode) bool {
+	if unqualified(w.name) == unqualified(r.name) {
+		return true
+	}
+	for _, alias := range r.aliases {
+		if alias == w.name || unqualified(alias) == unqualified(w.name) {
+			return true
+		}
+	}
+	return false
+}
+
+func unqualified(name string) string {
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+func errCannotResolve(w, r *schemaNode) error {
+	return fmt.Errorf("avro type %s written by the writer schema cannot be read as %s", w.typeName(), r.typeName())
+}
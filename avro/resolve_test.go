@@ -0,0 +1,222 @@
+package avro
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var writerSchema = &Schema{Definition: `{
+  "type": "record",
+  "name": "audit-event",
+  "fields": [
+    {"name": "created", "type": "string"},
+    {"name": "service", "type": "string"},
+    {"name": "retries", "type": "int"},
+    {"name": "latency", "type": "float"},
+    {"name": "status", "type": {"type": "enum", "name": "status", "symbols": ["attempted", "successful", "cancelled"]}},
+    {"name": "user", "type": ["null", "string"], "default": null},
+    {"name": "params", "type": {"type": "map", "values": "string"}},
+    {"name": "removed", "type": {"type": "array", "items": "string"}}
+  ]
+}`}
+
+var readerSchema = &Schema{Definition: `{
+  "type": "record",
+  "name": "events.audit_event",
+  "aliases": ["audit-event"],
+  "fields": [
+    {"name": "created", "type": "string"},
+    {"name": "service_name", "aliases": ["service"], "type": "string"},
+    {"name": "retries", "type": "long"},
+    {"name": "latency", "type": "double"},
+    {"name": "status", "type": {"type": "enum", "name": "status", "symbols": ["unknown", "attempted", "successful"], "default": "unknown"}},
+    {"name": "user", "type": ["null", "string"], "default": null},
+    {"name": "params", "type": {"type": "map", "values": "bytes"}},
+    {"name": "caller", "type": "string", "default": "none"},
+    {"name": "hops", "type": ["int", "null"], "default": 1}
+  ]
+}`}
+
+type writtenEvent struct {
+	Created string            `avro:"created"`
+	Service string            `avro:"service"`
+	Retries int32             `avro:"retries"`
+	Latency float32           `avro:"latency"`
+	Status  string            `avro:"status"`
+	User    *string           `avro:"user"`
+	Params  map[string]string `avro:"params"`
+	Removed []string          `avro:"removed"`
+}
+
+type readEvent struct {
+	Created string            `avro:"created"`
+	Service string            `avro:"service_name"`
+	Retries int64             `avro:"retries"`
+	Latency float64           `avro:"latency"`
+	Status  string            `avro:"status"`
+	User    *string           `avro:"user"`
+	Params  map[string][]byte `avro:"params"`
+	Caller  string            `avro:"caller"`
+	Hops    *int32            `avro:"hops"`
+}
+
+func TestUnitUnmarshalFrom(t *testing.T) {
+	user := "bob"
+	written := writtenEvent{
+		Created: "2018-06-14T09:30:00Z",
+		Service: "dp-dataset-api",
+		Retries: 3,
+		Latency: 1.5,
+		Status:  "successful",
+		User:    &user,
+		Params:  map[string]string{"dataset_id": "cpih01"},
+		Removed: []string{"a", "b"},
+	}
+
+	Convey("Data written with one schema is read with another using the resolution rules", t, func() {
+		b, err := writerSchema.Marshal(written)
+		So(err, ShouldBeNil)
+
+		var actual readEvent
+		err = readerSchema.UnmarshalFrom(writerSchema, b, &actual)
+		So(err, ShouldBeNil)
+
+		hops := int32(1)
+		So(actual, ShouldResemble, readEvent{
+			Created: written.Created,
+			Service: written.Service,
+			Retries: 3,
+			Latency: 1.5,
+			Status:  "successful",
+			User:    &user,
+			Params:  map[string][]byte{"dataset_id": []byte("cpih01")},
+			Caller:  "none",
+			Hops:    &hops,
+		})
+
+		Convey("and enum symbols the reader doesn't have are read as its default", func() {
+			written.Status = "cancelled"
+			written.User = nil
+			b, err := writerSchema.Marshal(written)
+			So(err, ShouldBeNil)
+
+			actual := readEvent{User: &user}
+			err = readerSchema.UnmarshalFrom(writerSchema, b, &actual)
+			So(err, ShouldBeNil)
+			So(actual.Status, ShouldEqual, "unknown")
+			So(actual.User, ShouldBeNil)
+		})
+	})
+
+	Convey("Reading with the schema that wrote the data is the same as Unmarshal", t, func() {
+		b, err := writerSchema.Marshal(written)
+		So(err, ShouldBeNil)
+
+		var actual writtenEvent
+		So(writerSchema.UnmarshalFrom(writerSchema, b, &actual), ShouldBeNil)
+		So(actual, ShouldResemble, written)
+	})
+
+	Convey("A reader field the writer doesn't have and that has no default returns an error", t, func() {
+		reader := &Schema{Definition: `{"type": "record", "name": "audit-event", "fields": [
+			{"name": "created", "type": "string"},
+			{"name": "caller", "type": "string"}
+		]}`}
+		b, err := writerSchema.Marshal(written)
+		So(err, ShouldBeNil)
+
+		var actual readEvent
+		So(reader.UnmarshalFrom(writerSchema, b, &actual), ShouldNotBeNil)
+	})
+
+	Convey("Types that cannot be promoted return an error", t, func() {
+		reader := &Schema{Definition: `{"type": "record", "name": "audit-event", "fields": [
+			{"name": "retries", "type": "string"}
+		]}`}
+		b, err := writerSchema.Marshal(written)
+		So(err, ShouldBeNil)
+
+		var actual struct {
+			Retries string `avro:"retries"`
+		}
+		So(reader.UnmarshalFrom(writerSchema, b, &actual), ShouldNotBeNil)
+	})
+}
+
+func TestUnitCompatibility(t *testing.T) {
+	v1 := &Schema{Definition: `{"type": "record", "name": "event", "fields": [
+		{"name": "created", "type": "string"},
+		{"name": "count", "type": "int"}
+	]}`}
+
+	Convey("Adding a field with a default is fully compatible", t, func() {
+		v2 := &Schema{Definition: `{"type": "record", "name": "event", "fields": [
+			{"name": "created", "type": "string"},
+			{"name": "count", "type": "int"},
+			{"name": "user", "type": "string", "default": ""}
+		]}`}
+		So(CheckCompatibility(v1, v2, Full), ShouldBeNil)
+
+		level, err := CompatibilityOf(v1, v2)
+		So(err, ShouldBeNil)
+		So(level, ShouldEqual, Full)
+	})
+
+	Convey("Adding a field without a default is only forward compatible", t, func() {
+		v2 := &Schema{Definition: `{"type": "record", "name": "event", "fields": [
+			{"name": "created", "type": "string"},
+			{"name": "count", "type": "int"},
+			{"name": "user", "type": "string"}
+		]}`}
+		level, err := CompatibilityOf(v1, v2)
+		So(err, ShouldBeNil)
+		So(level, ShouldEqual, Forward)
+
+		err = CheckCompatibility(v1, v2, Backward)
+		So(err, ShouldHaveSameTypeAs, &CompatibilityError{})
+		So(err.(*CompatibilityError).Reasons, ShouldResemble, []string{
+			"user: the reader's field has no default and the writer doesn't have it",
+		})
+	})
+
+	Convey("Promoting a type is only backward compatible", t, func() {
+		v2 := &Schema{Definition: `{"type": "record", "name": "event", "fields": [
+			{"name": "created", "type": "string"},
+			{"name": "count", "type": "long"}
+		]}`}
+		level, err := CompatibilityOf(v1, v2)
+		So(err, ShouldBeNil)
+		So(level, ShouldEqual, Backward)
+		So(CheckCompatibility(v1, v2, Forward).Error(), ShouldContainSubstring, "count: long cannot be read as int")
+	})
+
+	Convey("Changing a type is incompatible", t, func() {
+		v2 := &Schema{Definition: `{"type": "record", "name": "event", "fields": [
+			{"name": "created", "type": "string"},
+			{"name": "count", "type": "boolean"}
+		]}`}
+		level, err := CompatibilityOf(v1, v2)
+		So(err, ShouldBeNil)
+		So(level, ShouldEqual, Incompatible)
+		So(level.String(), ShouldEqual, "incompatible")
+	})
+
+	Convey("Removing an enum symbol is backward compatible only if the new enum has a default", t, func() {
+		enum := func(symbols, def string) *Schema {
+			return &Schema{Definition: `{"type": "enum", "name": "result", "symbols": [` + symbols + `]` + def + `}`}
+		}
+		previous := enum(`"attempted", "successful", "unsuccessful"`, "")
+
+		So(CheckCompatibility(previous, enum(`"attempted", "successful"`, ""), Backward), ShouldNotBeNil)
+		So(CheckCompatibility(previous, enum(`"attempted", "successful"`, `, "default": "attempted"`), Backward), ShouldBeNil)
+	})
+
+	Convey("Invalid schemas return an error", t, func() {
+		_, err := CompatibilityOf(v1, &Schema{Definition: "{"})
+		So(err, ShouldNotBeNil)
+
+		_, err = CompatibilityOf(v1, &Schema{Definition: `{"type": "enum", "name": "e", "symbols": ["a"], "default": "b"}`})
+		So(err, ShouldNotBeNil)
+	})
+}
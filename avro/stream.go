@@ -0,0 +1,79 @@
+package avro
+
+import (
+	"io"
+)
+
+// Decoder reads successive avro binary encoded values, written one after another with no framing, from a stream.
+// Only the bytes of the value being read are buffered, so memory use is bounded by the largest value in the stream
+// rather than the length of the stream.
+type Decoder struct {
+	schema *Schema
+	writer *Schema
+	d      decoder
+	err    error
+}
+
+// NewDecoder returns a Decoder that reads values of schema from r
+func NewDecoder(r io.Reader, schema *Schema) *Decoder {
+	return &Decoder{schema: schema, d: decoder{r: r}}
+}
+
+// NewResolvingDecoder returns a Decoder that reads values written with the writer schema from r and resolves them
+// against schema, as with Schema.UnmarshalFrom
+func NewResolvingDecoder(r io.Reader, writer, schema *Schema) *Decoder {
+	return &Decoder{schema: schema, writer: writer, d: decoder{r: r}}
+}
+
+// Decode reads the next value from the stream into the value pointed to by s. It returns io.EOF when the stream ends
+// between values and io.ErrUnexpectedEOF if it ends part way through one. Once a value has been partly read and
+// failed, the start of the next value cannot be found so every later call returns the same error.
+func (dec *Decoder) Decode(s interface{}) error {
+	if dec.err != nil {
+		return dec.err
+	}
+
+	if dec.d.pos == len(dec.d.buf) {
+		if err := dec.d.fill(1); err == io.ErrUnexpectedEOF {
+			return io.EOF
+		} else if err != nil {
+			dec.err = err
+			return err
+		}
+	}
+
+	consumed := dec.d.consumed()
+	err := dec.schema.decode(&dec.d, dec.writer, s)
+	if err != nil && dec.d.consumed() != consumed {
+		dec.err = err
+	}
+	return err
+}
+
+// Encoder writes avro binary encoded values one after another to a stream
+type Encoder struct {
+	schema *Schema
+	w      io.Writer
+	e      encoder
+}
+
+// NewEncoder returns an Encoder that writes values of schema to w
+func NewEncoder(w io.Writer, schema *Schema) *Encoder {
+	return &Encoder{schema: schema, w: w}
+}
+
+// Encode writes the avro encoding of s to the stream. Nothing is written if s cannot be encoded.
+func (enc *Encoder) Encode(s interface{}) error {
+	// a buffer grown by an unusually large value is not kept
+	if cap(enc.e.buf) > 64*1024 {
+		enc.e.buf = nil
+	}
+
+	enc.e.buf = enc.e.buf[:0]
+	if err := enc.schema.encode(&enc.e, s); err != nil {
+		return err
+	}
+
+	_, err := enc.w.Write(enc.e.buf)
+	return err
+}
@@ -0,0 +1,134 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeStream encodes count benchmark events, each with a different request id, one after another
+func writeStream(count int) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, &Schema{Definition: benchmarkSchema})
+	for i := 0; i < count; i++ {
+		data := benchmarkData
+		data.RequestID = fmt.Sprintf("request-%d", i)
+		if err := enc.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func TestUnitStream(t *testing.T) {
+	schema := &Schema{Definition: benchmarkSchema}
+
+	Convey("Values written by an Encoder are read back one at a time by a Decoder", t, func() {
+		b, err := writeStream(500)
+		So(err, ShouldBeNil)
+
+		for name, r := range map[string]io.Reader{
+			"in one read":      bytes.NewReader(b),
+			"a byte at a time": iotest.OneByteReader(bytes.NewReader(b)),
+			"in halves":        iotest.HalfReader(bytes.NewReader(b)),
+		} {
+			Convey("when the stream is read "+name, func() {
+				dec := NewDecoder(r, schema)
+				for i := 0; i < 500; i++ {
+					var actual benchmarkEvent
+					So(dec.Decode(&actual), ShouldBeNil)
+					So(actual.RequestID, ShouldEqual, fmt.Sprintf("request-%d", i))
+					So(actual.Params, ShouldResemble, benchmarkData.Params)
+				}
+
+				var actual benchmarkEvent
+				So(dec.Decode(&actual), ShouldEqual, io.EOF)
+			})
+		}
+	})
+
+	Convey("The decoder only buffers the value being read", t, func() {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf, schema)
+		large := benchmarkData
+		large.User = strings.Repeat("x", 100000)
+		So(enc.Encode(large), ShouldBeNil)
+		for i := 0; i < 1000; i++ {
+			So(enc.Encode(benchmarkData), ShouldBeNil)
+		}
+
+		dec := NewDecoder(&buf, schema)
+		var actual benchmarkEvent
+		So(dec.Decode(&actual), ShouldBeNil)
+		So(actual.User, ShouldEqual, large.User)
+
+		for i := 0; i < 1000; i++ {
+			So(dec.Decode(&actual), ShouldBeNil)
+			So(cap(dec.d.buf), ShouldBeLessThanOrEqualTo, 2*streamBufferSize)
+		}
+	})
+
+	Convey("A stream that ends part way through a value returns io.ErrUnexpectedEOF", t, func() {
+		b, err := writeStream(2)
+		So(err, ShouldBeNil)
+
+		dec := NewDecoder(bytes.NewReader(b[:len(b)-3]), schema)
+		var actual benchmarkEvent
+		So(dec.Decode(&actual), ShouldBeNil)
+		So(errors.Is(dec.Decode(&actual), io.ErrUnexpectedEOF), ShouldBeTrue)
+		So(errors.Is(dec.Decode(&actual), io.ErrUnexpectedEOF), ShouldBeTrue)
+	})
+
+	Convey("Errors from the reader are returned", t, func() {
+		readErr := errors.New("connection reset")
+		dec := NewDecoder(iotest.ErrReader(readErr), schema)
+		var actual benchmarkEvent
+		So(dec.Decode(&actual), ShouldEqual, readErr)
+	})
+
+	Convey("A type that does not match the schema does not stop the stream being read", t, func() {
+		b, err := writeStream(1)
+		So(err, ShouldBeNil)
+
+		dec := NewDecoder(bytes.NewReader(b), schema)
+		So(dec.Decode(&struct {
+			User int `avro:"user"`
+		}{}), ShouldNotBeNil)
+
+		var actual benchmarkEvent
+		So(dec.Decode(&actual), ShouldBeNil)
+		So(actual.RequestID, ShouldEqual, "request-0")
+	})
+
+	Convey("A resolving decoder reads values written with another schema", t, func() {
+		b, err := writeStream(2)
+		So(err, ShouldBeNil)
+
+		reader := &Schema{Definition: `{"type": "record", "name": "benchmark-event", "fields": [
+			{"name": "request_id", "type": "string"}
+		]}`}
+		dec := NewResolvingDecoder(bytes.NewReader(b), schema, reader)
+		for i := 0; i < 2; i++ {
+			var actual struct {
+				RequestID string `avro:"request_id"`
+			}
+			So(dec.Decode(&actual), ShouldBeNil)
+			So(actual.RequestID, ShouldEqual, fmt.Sprintf("request-%d", i))
+		}
+	})
+
+	Convey("Values that cannot be encoded are not written", t, func() {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf, schema)
+		So(enc.Encode(struct {
+			User int `avro:"user"`
+		}{}), ShouldNotBeNil)
+		So(buf.Len(), ShouldEqual, 0)
+	})
+}
@@ -17,7 +17,7 @@ var testSchema = `{ "type": "record",
 var testArraySchema = `{ "type": "record",
  "name": "example",
  "fields": [
-      {"name": "winning_years","type":["null",{"type":"array","items":"string"}]},
+      {"name": "winning_years","type":["null",{"type":"array","items":"string"}]}
  ]
 }`
 
@@ -154,11 +154,11 @@ type testData1 struct {
 }
 
 type testData2 struct {
-	Manager         string `avro:"manager"`
-	URI             string `avro:"-"`
-	HasChangedName  bool   `avro:"has_changed_name"`
-	NumberOfPlayers int32  `avro:"number_of_players"`
-	NumberOfYouths  int    `avro:"number_of_youths"`
+	Manager         string  `avro:"manager"`
+	URI             string  `avro:"-"`
+	HasChangedName  bool    `avro:"has_changed_name"`
+	NumberOfPlayers int32   `avro:"number_of_players"`
+	NumberOfYouths  uintptr `avro:"number_of_youths"`
 }
 
 type testData3 struct {
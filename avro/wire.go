@@ -0,0 +1,122 @@
+package avro
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// wireMagicByte starts every message in the Confluent wire format. It is followed by the big-endian 4-byte id of the
+// schema the payload was written with, then the avro binary payload.
+const (
+	wireMagicByte  = 0
+	wireHeaderSize = 5
+)
+
+// ErrInvalidWireFormat is returned when a message is not framed in the Confluent wire format
+var ErrInvalidWireFormat = errors.New("message is not in the confluent wire format")
+
+// WrapWireFormat frames an avro binary payload written with the schema registered with id in the Confluent wire format
+func WrapWireFormat(id int, payload []byte) ([]byte, error) {
+	if id < 0 || id > math.MaxInt32 {
+		return nil, fmt.Errorf("invalid schema id %d", id)
+	}
+
+	message := make([]byte, wireHeaderSize, wireHeaderSize+len(payload))
+	message[0] = wireMagicByte
+	binary.BigEndian.PutUint32(message[1:], uint32(id))
+	return append(message, payload...), nil
+}
+
+// UnwrapWireFormat returns the schema id and avro binary payload of a message framed in the Confluent wire format
+func UnwrapWireFormat(message []byte) (int, []byte, error) {
+	if len(message) < wireHeaderSize || message[0] != wireMagicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+
+	id := binary.BigEndian.Uint32(message[1:wireHeaderSize])
+	if id > math.MaxInt32 {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(id), message[wireHeaderSize:], nil
+}
+
+// WireEncoder marshals values with a schema and frames them in the Confluent wire format, registering the schema
+// under its subject the first time it is used
+type WireEncoder struct {
+	registry SchemaRegistry
+	subject  string
+	schema   *Schema
+
+	mu sync.Mutex
+	id int
+}
+
+// NewWireEncoder returns a WireEncoder that writes values with schema, registered in registry under subject
+func NewWireEncoder(registry SchemaRegistry, subject string, schema *Schema) *WireEncoder {
+	return &WireEncoder{registry: registry, subject: subject, schema: schema, id: -1}
+}
+
+// Marshal avro encodes s and frames it with the id of the encoder's schema
+func (e *WireEncoder) Marshal(ctx context.Context, s interface{}) ([]byte, error) {
+	id, err := e.schemaID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := e.schema.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return WrapWireFormat(id, payload)
+}
+
+// schemaID returns the registered id of the schema. A failed registration is retried by the next call.
+func (e *WireEncoder) schemaID(ctx context.Context) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.id < 0 {
+		id, err := e.registry.Register(ctx, e.subject, e.schema)
+		if err != nil {
+			return 0, err
+		}
+		e.id = id
+	}
+	return e.id, nil
+}
+
+// WireDecoder unmarshals messages framed in the Confluent wire format, looking up the schema each was written with
+// in a registry
+type WireDecoder struct {
+	registry SchemaRegistry
+	reader   *Schema
+}
+
+// NewWireDecoder returns a WireDecoder that reads messages with the schemas in registry. If reader is not nil messages
+// are resolved against it, as with Schema.UnmarshalFrom, so that values are read the same way whichever version of the
+// schema wrote them. Otherwise they are read with the schema that wrote them.
+func NewWireDecoder(registry SchemaRegistry, reader *Schema) *WireDecoder {
+	return &WireDecoder{registry: registry, reader: reader}
+}
+
+// Unmarshal parses a message framed in the Confluent wire format and stores the result in the value pointed to by s
+func (d *WireDecoder) Unmarshal(ctx context.Context, message []byte, s interface{}) error {
+	id, payload, err := UnwrapWireFormat(message)
+	if err != nil {
+		return err
+	}
+
+	writer, err := d.registry.SchemaByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if d.reader == nil {
+		return writer.Unmarshal(payload, s)
+	}
+	return d.reader.UnmarshalFrom(writer, payload, s)
+}
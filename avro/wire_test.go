@@ -0,0 +1,187 @@
+package avro
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// countingRegistry counts the calls made to the registry it wraps
+type countingRegistry struct {
+	SchemaRegistry
+	byID, latest, register int
+	err                    error
+}
+
+func (r *countingRegistry) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	r.byID++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.SchemaRegistry.SchemaByID(ctx, id)
+}
+
+func (r *countingRegistry) LatestSchema(ctx context.Context, subject string) (int, *Schema, error) {
+	r.latest++
+	return r.SchemaRegistry.LatestSchema(ctx, subject)
+}
+
+func (r *countingRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	r.register++
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.SchemaRegistry.Register(ctx, subject, schema)
+}
+
+func TestUnitWireFormat(t *testing.T) {
+	Convey("Payloads are framed with the magic byte and big-endian schema id", t, func() {
+		message, err := WrapWireFormat(258, []byte{1, 2})
+		So(err, ShouldBeNil)
+		So(message, ShouldResemble, []byte{0, 0, 0, 1, 2, 1, 2})
+
+		id, payload, err := UnwrapWireFormat(message)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 258)
+		So(payload, ShouldResemble, []byte{1, 2})
+	})
+
+	Convey("Messages that are not framed return ErrInvalidWireFormat", t, func() {
+		for _, message := range [][]byte{nil, {0, 0, 0, 1}, {1, 0, 0, 0, 1}, {0, 0x80, 0, 0, 0}} {
+			_, _, err := UnwrapWireFormat(message)
+			So(err, ShouldEqual, ErrInvalidWireFormat)
+		}
+
+		_, err := WrapWireFormat(-1, nil)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestUnitWireEncoder(t *testing.T) {
+	ctx := context.Background()
+	user := "bob"
+	written := writtenEvent{
+		Created: "now",
+		Service: "dp-dataset-api",
+		Status:  "attempted",
+		User:    &user,
+		Params:  map[string]string{},
+		Removed: []string{},
+	}
+
+	Convey("Values round trip through the wire format using the registry", t, func() {
+		registry := &countingRegistry{SchemaRegistry: NewMemoryRegistry()}
+		encoder := NewWireEncoder(registry, "audit-events-value", writerSchema)
+
+		message, err := encoder.Marshal(ctx, written)
+		So(err, ShouldBeNil)
+		So(message[:5], ShouldResemble, []byte{0, 0, 0, 0, 1})
+
+		_, err = encoder.Marshal(ctx, written)
+		So(err, ShouldBeNil)
+		So(registry.register, ShouldEqual, 1)
+
+		var actual writtenEvent
+		err = NewWireDecoder(registry, nil).Unmarshal(ctx, message, &actual)
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, written)
+
+		Convey("and are resolved against the reader schema when one is given", func() {
+			var actual readEvent
+			err = NewWireDecoder(registry, readerSchema).Unmarshal(ctx, message, &actual)
+			So(err, ShouldBeNil)
+			So(actual.Service, ShouldEqual, written.Service)
+			So(actual.Caller, ShouldEqual, "none")
+		})
+	})
+
+	Convey("Registry errors are returned and registration is retried", t, func() {
+		registry := &countingRegistry{SchemaRegistry: NewMemoryRegistry(), err: errors.New("registry unavailable")}
+		encoder := NewWireEncoder(registry, "audit-events-value", writerSchema)
+
+		_, err := encoder.Marshal(ctx, written)
+		So(err, ShouldEqual, registry.err)
+
+		registry.err = nil
+		_, err = encoder.Marshal(ctx, written)
+		So(err, ShouldBeNil)
+		So(registry.register, ShouldEqual, 2)
+	})
+
+	Convey("Messages written with an unknown schema return ErrSchemaNotFound", t, func() {
+		message, err := WrapWireFormat(7, []byte{})
+		So(err, ShouldBeNil)
+
+		var actual writtenEvent
+		err = NewWireDecoder(NewMemoryRegistry(), nil).Unmarshal(ctx, message, &actual)
+		So(err, ShouldEqual, ErrSchemaNotFound)
+	})
+}
+
+func TestUnitRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	Convey("The memory registry gives each definition one id across subjects", t, func() {
+		registry := NewMemoryRegistry()
+
+		id, err := registry.Register(ctx, "a", writerSchema)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 1)
+
+		id, err = registry.Register(ctx, "b", &Schema{Definition: writerSchema.Definition})
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 1)
+
+		id, err = registry.Register(ctx, "a", readerSchema)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 2)
+
+		id, schema, err := registry.LatestSchema(ctx, "a")
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 2)
+		So(schema, ShouldEqual, readerSchema)
+
+		_, _, err = registry.LatestSchema(ctx, "c")
+		So(err, ShouldEqual, ErrSchemaNotFound)
+
+		_, err = registry.SchemaByID(ctx, 3)
+		So(err, ShouldEqual, ErrSchemaNotFound)
+
+		_, err = registry.Register(ctx, "a", &Schema{Definition: "{"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("The cached registry only looks up each id and registers each schema once", t, func() {
+		memory := NewMemoryRegistry()
+		id, err := memory.Register(ctx, "a", writerSchema)
+		So(err, ShouldBeNil)
+
+		counting := &countingRegistry{SchemaRegistry: memory}
+		cached := NewCachedRegistry(counting)
+
+		for i := 0; i < 3; i++ {
+			schema, err := cached.SchemaByID(ctx, id)
+			So(err, ShouldBeNil)
+			So(schema, ShouldEqual, writerSchema)
+
+			registered, err := cached.Register(ctx, "b", readerSchema)
+			So(err, ShouldBeNil)
+			So(registered, ShouldEqual, 2)
+
+			latest, schema, err := cached.LatestSchema(ctx, "b")
+			So(err, ShouldBeNil)
+			So(latest, ShouldEqual, 2)
+			So(schema, ShouldEqual, readerSchema)
+		}
+
+		So(counting.byID, ShouldEqual, 1)
+		So(counting.register, ShouldEqual, 1)
+		So(counting.latest, ShouldEqual, 3)
+
+		counting.err = errors.New("registry unavailable")
+		_, err = cached.SchemaByID(ctx, 5)
+		So(err, ShouldEqual, counting.err)
+	})
+}
@@ -19,8 +19,8 @@ func Check(auditor Auditor, action string, handle func(http.ResponseWriter, *htt
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		vars := mux.Vars(r)
-		auditParams := audit.GetParameters(ctx, r.URL.EscapedPath(), vars)
-		logData := audit.ToLogData(auditParams)
+		auditParams := audit.GetAuditorParameters(ctx, auditor, r.URL.EscapedPath(), vars)
+		logData := audit.RedactedLogData(auditor, auditParams)
 
 		log.Info(ctx, "checking for an identity in request context", log.HTTP(r, 0, 0, nil, nil), logData)
 
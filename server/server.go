@@ -1,9 +1,11 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"context"
@@ -16,9 +18,14 @@ import (
 const RequestIDHandlerKey string = "RequestID"
 const LogHandlerKey string = "Log"
 
+// defaultShutdownTimeout is the DefaultShutdownTimeout of servers created with New, and the time registered
+// components are given to close on servers without one
+const defaultShutdownTimeout = 10 * time.Second
+
 // Server is a http.Server with sensible defaults, which supports
 // configurable middleware and timeouts, and shuts down cleanly
-// on SIGINT/SIGTERM
+// on SIGINT/SIGTERM, closing the components registered with it
+// once the HTTP server has drained
 type Server struct {
 	http.Server
 	Middleware             map[string]alice.Constructor
@@ -28,6 +35,8 @@ type Server struct {
 	KeyFile                string
 	DefaultShutdownTimeout time.Duration
 	HandleOSSignals        bool
+
+	closers ShutdownCoordinator
 }
 
 // New creates a new server
@@ -51,7 +60,7 @@ func New(bindAddr string, router http.Handler) *Server {
 			MaxHeaderBytes:    0,
 		},
 		HandleOSSignals:        true,
-		DefaultShutdownTimeout: 10 * time.Second,
+		DefaultShutdownTimeout: defaultShutdownTimeout,
 	}
 }
 
@@ -93,15 +102,45 @@ func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
 	return s.ListenAndServe()
 }
 
+// RegisterCloser adds a component to be closed when the server shuts down,
+// after the HTTP server has drained. Components are closed lowest priority
+// first, and given up on after timeout if it is above zero. Together they
+// are given up to DefaultShutdownTimeout, or 10 seconds if it is not set,
+// however long the HTTP server took.
+func (s *Server) RegisterCloser(name string, priority int, timeout time.Duration, closer Closer) {
+	s.closers.Register(name, priority, timeout, closer)
+}
+
 // Shutdown will gracefully shutdown the server, using a default shutdown
-// timeout if a context is not provided.
+// timeout if a context is not provided. Once the HTTP server has drained,
+// or failed to, the registered components are closed with a timeout of
+// their own, as the HTTP server may have used up ctx. The errors of the
+// HTTP server and of every component that failed are returned together.
 func (s *Server) Shutdown(ctx context.Context) error {
 
 	if ctx == nil {
-		ctx, _ = context.WithTimeout(context.Background(), s.DefaultShutdownTimeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), s.DefaultShutdownTimeout)
+		defer cancel()
+	}
+
+	var errs []error
+	if err := s.Server.Shutdown(ctx); err != nil {
+		log.Error(ctx, "http server failed to shut down gracefully", err)
+		errs = append(errs, err)
+	}
+
+	closeTimeout := s.DefaultShutdownTimeout
+	if closeTimeout <= 0 {
+		closeTimeout = defaultShutdownTimeout
+	}
+	closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), closeTimeout)
+	defer cancel()
+	if err := s.closers.Close(closeCtx); err != nil {
+		errs = append(errs, err)
 	}
 
-	return s.Server.Shutdown(ctx)
+	return errors.Join(errs...)
 }
 
 // Close is simply a wrapper around Shutdown that enables Server to be treated as a Closable
@@ -122,12 +161,14 @@ func (s *Server) listenAndServe() error {
 func (s *Server) listenAndServeHandleOSSignals() error {
 
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, os.Kill)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
 
 	s.listenAndServeAsync()
 
 	<-stop
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.DefaultShutdownTimeout)
+	defer cancel()
 	return s.Shutdown(ctx)
 }
 
@@ -136,14 +177,14 @@ func (s *Server) listenAndServeAsync() {
 	s.prep()
 	if len(s.CertFile) > 0 || len(s.KeyFile) > 0 {
 		go func() {
-			if err := s.Server.ListenAndServeTLS(s.CertFile, s.KeyFile); err != nil {
+			if err := s.Server.ListenAndServeTLS(s.CertFile, s.KeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Error(context.Background(), "http server returned error", err)
 				os.Exit(1)
 			}
 		}()
 	} else {
 		go func() {
-			if err := s.Server.ListenAndServe(); err != nil {
+			if err := s.Server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Error(context.Background(), "http server returned error", err)
 				os.Exit(1)
 			}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/log.go/v2/log"
+)
+
+// Closer is a component that must be closed when the server shuts down, such as a kafka producer, an audit.Auditor
+// or a database client
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// CloserFunc is a function that can be registered as a Closer
+type CloserFunc func(ctx context.Context) error
+
+// Close calls f
+func (f CloserFunc) Close(ctx context.Context) error {
+	return f(ctx)
+}
+
+type namedCloser struct {
+	name     string
+	priority int
+	timeout  time.Duration
+	closer   Closer
+}
+
+// ShutdownCoordinator closes the components registered with it in order of their priority. The zero value is ready
+// to use.
+type ShutdownCoordinator struct {
+	mu      sync.Mutex
+	closers []namedCloser
+	closed  bool
+}
+
+// Register adds closer to be closed with the others, lowest priority first and in the order they were registered
+// when they have the same priority. If timeout is above zero, closer is given up on once it has taken that long.
+func (c *ShutdownCoordinator) Register(name string, priority int, timeout time.Duration, closer Closer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closers = append(c.closers, namedCloser{name: name, priority: priority, timeout: timeout, closer: closer})
+}
+
+// Close closes every registered component, even if some of them fail, and returns their errors joined together.
+// Components still being closed when ctx is done are given up on. Only the first call closes the components, and
+// later calls return nil.
+func (c *ShutdownCoordinator) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	closers := append([]namedCloser(nil), c.closers...)
+	c.mu.Unlock()
+
+	sort.SliceStable(closers, func(i, j int) bool { return closers[i].priority < closers[j].priority })
+
+	var errs []error
+	for _, nc := range closers {
+		if err := nc.close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", nc.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// close closes the component, returning the context's error if it does not finish in time
+func (nc namedCloser) close(ctx context.Context) error {
+	if nc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nc.timeout)
+		defer cancel()
+	}
+
+	logData := log.Data{"closer": nc.name, "priority": nc.priority}
+	log.Info(ctx, "closing component", logData)
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- nc.closer.Close(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	logData["duration"] = time.Since(start).String()
+	if err != nil {
+		log.Error(ctx, "failed to close component", err, logData)
+		return err
+	}
+	log.Info(ctx, "closed component", logData)
+	return nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShutdownCoordinator(t *testing.T) {
+	Convey("given components registered with a shutdown coordinator", t, func() {
+		var c ShutdownCoordinator
+		var closed []string
+		closer := func(name string, err error) Closer {
+			return CloserFunc(func(ctx context.Context) error {
+				closed = append(closed, name)
+				return err
+			})
+		}
+
+		c.Register("kafka producer", 2, 0, closer("kafka producer", nil))
+		c.Register("auditor", 1, 0, closer("auditor", nil))
+		c.Register("mongo", 2, 0, closer("mongo", nil))
+
+		Convey("then they are closed lowest priority first and in the order they were registered", func() {
+			So(c.Close(context.Background()), ShouldBeNil)
+			So(closed, ShouldResemble, []string{"auditor", "kafka producer", "mongo"})
+
+			Convey("and only once", func() {
+				So(c.Close(context.Background()), ShouldBeNil)
+				So(closed, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("then every component is closed and their errors are returned together", func() {
+			errProducer := errors.New("producer failed")
+			errMongo := errors.New("mongo failed")
+			c.Register("failing producer", 0, 0, closer("failing producer", errProducer))
+			c.Register("failing mongo", 3, 0, closer("failing mongo", errMongo))
+
+			err := c.Close(context.Background())
+			So(closed, ShouldHaveLength, 5)
+			So(errors.Is(err, errProducer), ShouldBeTrue)
+			So(errors.Is(err, errMongo), ShouldBeTrue)
+			So(err.Error(), ShouldStartWith, "failing producer: producer failed")
+		})
+
+		Convey("then a component that takes longer than its timeout is given up on", func() {
+			c.Register("slow", 1, 10*time.Millisecond, CloserFunc(func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			}))
+
+			start := time.Now()
+			err := c.Close(context.Background())
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(closed, ShouldResemble, []string{"auditor", "kafka producer", "mongo"})
+		})
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("given a server with a request in flight and a registered component", t, func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		served := make(chan struct{})
+		h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer close(served)
+			close(started)
+			<-release
+		})
+
+		sPort, s := newWithPort(h)
+		s.HandleOSSignals = false
+		go func() {
+			s.ListenAndServe()
+		}()
+		time.Sleep(time.Millisecond * 20)
+
+		go func() {
+			if res, err := http.Get("http://localhost" + sPort); err == nil {
+				res.Body.Close()
+			}
+		}()
+		<-started
+
+		drained := make(chan bool, 1)
+		s.RegisterCloser("auditor", 0, time.Second, CloserFunc(func(ctx context.Context) error {
+			select {
+			case <-served:
+				drained <- true
+			default:
+				drained <- false
+			}
+			return errors.New("auditor failed")
+		}))
+
+		Convey("then the component is closed after the request has been served", func() {
+			shutdown := make(chan error, 1)
+			go func() {
+				shutdown <- s.Shutdown(nil)
+			}()
+			time.Sleep(time.Millisecond * 20)
+			close(release)
+
+			So(<-shutdown, ShouldNotBeNil)
+			So(<-drained, ShouldBeTrue)
+		})
+
+		Convey("then the component is still closed with time to do so if the request is not served in time", func() {
+			s.DefaultShutdownTimeout = time.Second
+			s.RegisterCloser("producer", 1, 0, CloserFunc(func(ctx context.Context) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) < time.Second/2 {
+					return errors.New("expected the time left to close components")
+				}
+				return nil
+			}))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := s.Shutdown(ctx)
+			close(release)
+
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(err.Error(), ShouldNotContainSubstring, "producer")
+			So(<-drained, ShouldBeFalse)
+		})
+
+		Convey("then the component is given time to close by a server without a default shutdown timeout", func() {
+			s.DefaultShutdownTimeout = 0
+			closed := make(chan error, 1)
+			s.RegisterCloser("producer", 1, 0, CloserFunc(func(ctx context.Context) error {
+				closed <- ctx.Err()
+				return nil
+			}))
+
+			shutdown := make(chan error, 1)
+			go func() {
+				shutdown <- s.Shutdown(context.Background())
+			}()
+			time.Sleep(time.Millisecond * 20)
+			close(release)
+
+			So(<-shutdown, ShouldNotBeNil)
+			So(<-closed, ShouldBeNil)
+		})
+	})
+}